@@ -25,12 +25,16 @@ type Client struct {
 	URL             *url.URL
 	HTTPClient      *http.Client
 	StreamingClient *http.Client
+	// StreamStallTimeout ends a stream with ErrStreamStalled when nothing is
+	// received for this long. Zero disables the check.
+	StreamStallTimeout time.Duration
 	Auth
 }
 
 type Config struct {
-	Address *url.URL
-	Token   string
+	Address            *url.URL
+	Token              string
+	StreamStallTimeout time.Duration
 	OAuth2Config
 }
 
@@ -55,15 +59,17 @@ func (c *Client) CreateJob(repo string, query Query) (string, error) {
 		ID string `json:"id"`
 	}
 	var humioQuery struct {
-		QueryString string `json:"queryString"`
-		Start       string `json:"start,omitempty"`
-		End         string `json:"end,omitempty"`
-		Live        bool   `json:"isLive"`
+		QueryString string            `json:"queryString"`
+		Start       string            `json:"start,omitempty"`
+		End         string            `json:"end,omitempty"`
+		Live        bool              `json:"isLive"`
+		Arguments   map[string]string `json:"arguments,omitempty"`
 	}
 	humioQuery.QueryString = query.LSQL
 	humioQuery.Start = query.Start
 	humioQuery.End = query.End
-	humioQuery.Live = false
+	humioQuery.Live = query.IsLive
+	humioQuery.Arguments = query.Arguments
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(humioQuery)
 	if err != nil {
@@ -72,7 +78,7 @@ func (c *Client) CreateJob(repo string, query Query) (string, error) {
 		return "", backend.PluginError(err)
 	}
 
-	err = c.Fetch(http.MethodPost, "api/v1/repositories/"+url.QueryEscape(repo)+"/queryjobs", &buf, &jsonResponse)
+	err = c.Fetch(http.MethodPost, "api/v1/repositories/"+url.PathEscape(repo)+"/queryjobs", &buf, &jsonResponse)
 	if err != nil {
 		return "", err
 	}
@@ -81,13 +87,13 @@ func (c *Client) CreateJob(repo string, query Query) (string, error) {
 }
 
 func (c *Client) DeleteJob(repo string, id string) error {
-	return c.Fetch(http.MethodDelete, "api/v1/repositories/"+url.QueryEscape(repo)+"/queryjobs/"+id, nil, nil)
+	return c.Fetch(http.MethodDelete, "api/v1/repositories/"+url.PathEscape(repo)+"/queryjobs/"+id, nil, nil)
 }
 
 func (c *Client) PollJob(repo string, id string) (QueryResult, error) {
 	var jsonResponse QueryResult
 
-	err := c.Fetch(http.MethodGet, "api/v1/repositories/"+url.QueryEscape(repo)+"/queryjobs/"+id, nil, &jsonResponse)
+	err := c.Fetch(http.MethodGet, "api/v1/repositories/"+url.PathEscape(repo)+"/queryjobs/"+id, nil, &jsonResponse)
 	if err != nil {
 		return QueryResult{}, err
 	}
@@ -122,6 +128,146 @@ func (c *Client) ListRepos() ([]string, error) {
 	return f, nil
 }
 
+type searchDomainItem struct {
+	Typename string `graphql:"__typename"`
+	Name     string
+	View     struct {
+		Connections []struct {
+			Repository struct {
+				Name string
+			}
+			Filter string
+		}
+	} `graphql:"... on View"`
+}
+
+// ListSearchDomains returns every repository and view, sorted by name. Views
+// include the repositories they are connected to.
+func (c *Client) ListSearchDomains() ([]SearchDomain, error) {
+	var query struct {
+		SearchDomains []searchDomainItem `graphql:"searchDomains"`
+	}
+
+	err := c.GraphQLQuery(&query, nil)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+
+	domains := make([]SearchDomain, 0, len(query.SearchDomains))
+	for _, d := range query.SearchDomains {
+		domain := SearchDomain{
+			Name: d.Name,
+			Type: SearchDomainTypeRepository,
+		}
+		if d.Typename == "View" {
+			domain.Type = SearchDomainTypeView
+			for _, conn := range d.View.Connections {
+				domain.Connections = append(domain.Connections, ViewConnection{
+					Repository: conn.Repository.Name,
+					Filter:     conn.Filter,
+				})
+			}
+		}
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return strings.ToLower(domains[i].Name) < strings.ToLower(domains[j].Name)
+	})
+
+	return domains, nil
+}
+
+type searchDomainMetadataItem struct {
+	Typename    string `graphql:"__typename"`
+	Name        string
+	Description *string
+	Repository  struct {
+		TimeBasedRetention        *float64
+		IngestSizeBasedRetention  *float64
+		StorageSizeBasedRetention *float64
+		CompressedByteSize        *int64
+		UncompressedByteSize      *int64
+	} `graphql:"... on Repository"`
+}
+
+// ListRepoMetadata returns the type, description, retention and size of every
+// repository and view, sorted by name.
+func (c *Client) ListRepoMetadata() ([]RepositoryMetadata, error) {
+	var query struct {
+		SearchDomains []searchDomainMetadataItem `graphql:"searchDomains"`
+	}
+
+	err := c.GraphQLQuery(&query, nil)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+
+	metadata := make([]RepositoryMetadata, 0, len(query.SearchDomains))
+	for _, d := range query.SearchDomains {
+		m := RepositoryMetadata{
+			Name: d.Name,
+			Type: SearchDomainTypeView,
+		}
+		if d.Description != nil {
+			m.Description = *d.Description
+		}
+		if d.Typename == "Repository" {
+			m.Type = SearchDomainTypeRepository
+			m.TimeBasedRetention = d.Repository.TimeBasedRetention
+			m.IngestSizeBasedRetention = d.Repository.IngestSizeBasedRetention
+			m.StorageSizeBasedRetention = d.Repository.StorageSizeBasedRetention
+			m.CompressedByteSize = d.Repository.CompressedByteSize
+			m.UncompressedByteSize = d.Repository.UncompressedByteSize
+		}
+		metadata = append(metadata, m)
+	}
+	sort.Slice(metadata, func(i, j int) bool {
+		return strings.ToLower(metadata[i].Name) < strings.ToLower(metadata[j].Name)
+	})
+
+	return metadata, nil
+}
+
+type savedQueryItem struct {
+	ID          string
+	Name        string
+	DisplayName string
+	Description string
+	Query       struct {
+		QueryString string
+	}
+}
+
+// ListSavedSearches returns the saved searches of a repository or view, sorted by name.
+func (c *Client) ListSavedSearches(repo string) ([]SavedSearch, error) {
+	var query struct {
+		SearchDomain struct {
+			SavedQueries []savedQueryItem
+		} `graphql:"searchDomain(name: $name)"`
+	}
+
+	err := c.GraphQLQuery(&query, map[string]interface{}{"name": repo})
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+
+	searches := make([]SavedSearch, 0, len(query.SearchDomain.SavedQueries))
+	for _, q := range query.SearchDomain.SavedQueries {
+		searches = append(searches, SavedSearch{
+			ID:          q.ID,
+			Name:        q.Name,
+			DisplayName: q.DisplayName,
+			Description: q.Description,
+			QueryString: q.Query.QueryString,
+		})
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return strings.ToLower(searches[i].Name) < strings.ToLower(searches[j].Name)
+	})
+
+	return searches, nil
+}
+
 func (c *Client) OauthClientSecretHealthCheck() error {
 	// Check if we can auth with oauth2 client secret, if we can run a test query
 	if c.OAuth2ClientID != "" && c.OAuth2ClientSecret != "" {
@@ -165,7 +311,7 @@ func (c *Client) GraphQLQuery(query interface{}, variables map[string]interface{
 	if err != nil {
 		return backend.PluginError(err)
 	}
-	return client.Query(context.Background(), query, variables)
+	return graphQLAPIError(client.Query(context.Background(), query, variables))
 }
 
 func NewClient(config Config, httpOpts httpclient.Options, streamingOpts httpclient.Options) (*Client, error) {
@@ -180,6 +326,7 @@ func NewClient(config Config, httpOpts httpclient.Options, streamingOpts httpcli
 			},
 			AccessToken: config.Token,
 		},
+		StreamStallTimeout: config.StreamStallTimeout,
 	}
 
 	httpOpts.Header.Add("Content-Type", "application/json")
@@ -197,6 +344,18 @@ func NewClient(config Config, httpOpts httpclient.Options, streamingOpts httpcli
 	return client, nil
 }
 
+// Close closes the idle connections of the HTTP clients. Requests still in
+// flight are not interrupted.
+func (c *Client) Close() error {
+	if c.HTTPClient != nil {
+		c.HTTPClient.CloseIdleConnections()
+	}
+	if c.StreamingClient != nil {
+		c.StreamingClient.CloseIdleConnections()
+	}
+	return nil
+}
+
 func newStreamingClient(opts httpclient.Options) (*http.Client, error) {
 	c, err := httpclient.NewProvider().New(opts)
 	if err != nil {
@@ -206,6 +365,7 @@ func newStreamingClient(opts httpclient.Options) (*http.Client, error) {
 }
 
 type ErrorResponse struct {
+	Code   string `json:"code,omitempty"`
 	Detail string `json:"detail"`
 }
 
@@ -317,7 +477,7 @@ func (c *Client) fetchWithRetry(method string, path string, body *bytes.Buffer,
 		return json.NewDecoder(res.Body).Decode(&out)
 	}
 	if res.StatusCode == http.StatusNoContent {
-		return fmt.Errorf("%s %s", res.Status, "No content returned from request")
+		return &APIError{StatusCode: res.StatusCode, Status: res.Status, Detail: "No content returned from request", Method: method, Path: path}
 	}
 
 	if c.handleOAuth2AuthError(isRetry, res.StatusCode) {
@@ -325,16 +485,12 @@ func (c *Client) fetchWithRetry(method string, path string, body *bytes.Buffer,
 		return c.fetchWithRetry(method, path, bytes.NewBuffer(bodyBytes), out, true)
 	}
 
-	var errResponse ErrorResponse
-	if err := json.NewDecoder(res.Body).Decode(&errResponse); err != nil {
-		log.DefaultLogger.Warn("failed to decode body as json", "error", err)
-		stringErr, err := io.ReadAll(res.Body)
-		if err != nil {
-			return fmt.Errorf("%s %s", res.Status, "failed to read response body")
-		}
-		return fmt.Errorf("%s %s", res.Status, string(stringErr))
+	errBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.DefaultLogger.Warn("failed to read response body", "error", err)
+		return &APIError{StatusCode: res.StatusCode, Status: res.Status, Detail: "failed to read response body", Method: method, Path: path}
 	}
-	return fmt.Errorf("%s %s", res.Status, strings.TrimSpace(errResponse.Detail))
+	return newAPIError(res, method, path, errBody)
 }
 
 func (c *Client) Stream(ctx context.Context, method string, path string, query Query, ch chan StreamingResults) error {
@@ -345,9 +501,18 @@ func (c *Client) streamWithRetry(ctx context.Context, method string, path string
 	var humioQuery struct {
 		QueryString string `json:"queryString"`
 		Live        bool   `json:"isLive"`
+		Start       any    `json:"start,omitempty"`
 	}
 	humioQuery.QueryString = query.LSQL
 	humioQuery.Live = true
+	if query.Start != "" {
+		// absolute starts are sent as milliseconds, relative ones such as 5m as is
+		if ms, err := strconv.ParseInt(query.Start, 10, 64); err == nil {
+			humioQuery.Start = ms
+		} else {
+			humioQuery.Start = query.Start
+		}
+	}
 
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(humioQuery)
@@ -359,7 +524,12 @@ func (c *Client) streamWithRetry(ctx context.Context, method string, path string
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, &buf)
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := newStallWatchdog(c.StreamStallTimeout, cancel)
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(reqCtx, method, url, &buf)
 	if err != nil {
 		return err
 	}
@@ -367,6 +537,9 @@ func (c *Client) streamWithRetry(ctx context.Context, method string, path string
 
 	res, err := c.StreamingClient.Do(req)
 	if err != nil {
+		if watchdog.Stalled() {
+			return ErrStreamStalled
+		}
 		return err
 	}
 	defer func() {
@@ -380,10 +553,11 @@ func (c *Client) streamWithRetry(ctx context.Context, method string, path string
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("stream request failed with status: %s", res.Status)
+		errBody, _ := io.ReadAll(res.Body)
+		return newAPIError(res, method, path, errBody)
 	}
 
-	d := json.NewDecoder(res.Body)
+	d := json.NewDecoder(watchdog.Reader(res.Body))
 
 	for {
 		select {
@@ -396,10 +570,26 @@ func (c *Client) streamWithRetry(ctx context.Context, method string, path string
 		}
 		var result StreamingResults
 		if err := d.Decode(&result); err != nil {
+			if watchdog.Stalled() {
+				return ErrStreamStalled
+			}
+			if ctx.Err() == context.Canceled {
+				return nil
+			}
 			return fmt.Errorf("error decoding stream result: %w", err)
 		}
 		if result != nil && ch != nil {
-			ch <- result
+			sent := false
+			watchdog.Blocked(func() {
+				select {
+				case ch <- result:
+					sent = true
+				case <-ctx.Done():
+				}
+			})
+			if !sent {
+				return nil
+			}
 		}
 	}
 }
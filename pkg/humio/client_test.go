@@ -86,6 +86,94 @@ func TestClient(t *testing.T) {
 		require.Len(t, r, 2)
 	})
 
+	t.Run("it lists search domains with view connections", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/graphql", func(w http.ResponseWriter, req *http.Request) {
+			testMethod(t, req, http.MethodPost)
+			listRes := `{
+				  "data": {
+				    "searchDomains": [
+							{ "__typename": "View", "name": "view1", "connections": [
+								{ "repository": { "name": "repo1" }, "filter": "#type=accesslog" }
+							] },
+							{ "__typename": "Repository", "name": "repo1" }
+						]
+				  }
+			}`
+			fmt.Fprint(w, listRes) //nolint:errcheck
+		})
+
+		r, err := testClient.ListSearchDomains()
+		require.Nil(t, err)
+		require.Equal(t, []humio.SearchDomain{
+			{Name: "repo1", Type: humio.SearchDomainTypeRepository},
+			{Name: "view1", Type: humio.SearchDomainTypeView, Connections: []humio.ViewConnection{{Repository: "repo1", Filter: "#type=accesslog"}}},
+		}, r)
+	})
+
+	t.Run("it lists repository metadata", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/graphql", func(w http.ResponseWriter, req *http.Request) {
+			testMethod(t, req, http.MethodPost)
+			listRes := `{
+				  "data": {
+				    "searchDomains": [
+							{ "__typename": "View", "name": "view1", "description": null },
+							{
+								"__typename": "Repository",
+								"name": "repo1",
+								"description": "main repo",
+								"timeBasedRetention": 30,
+								"ingestSizeBasedRetention": null,
+								"storageSizeBasedRetention": null,
+								"compressedByteSize": 1024,
+								"uncompressedByteSize": 8192
+							}
+						]
+				  }
+			}`
+			fmt.Fprint(w, listRes) //nolint:errcheck
+		})
+
+		r, err := testClient.ListRepoMetadata()
+		require.Nil(t, err)
+		require.Len(t, r, 2)
+		require.Equal(t, humio.SearchDomainTypeRepository, r[0].Type)
+		require.Equal(t, "main repo", r[0].Description)
+		require.Equal(t, 30.0, *r[0].TimeBasedRetention)
+		require.Nil(t, r[0].IngestSizeBasedRetention)
+		require.Equal(t, int64(8192), *r[0].UncompressedByteSize)
+		require.Equal(t, humio.SearchDomainTypeView, r[1].Type)
+		require.Nil(t, r[1].CompressedByteSize)
+	})
+
+	t.Run("it lists saved searches", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/graphql", func(w http.ResponseWriter, req *http.Request) {
+			testMethod(t, req, http.MethodPost)
+			listRes := `{
+				  "data": {
+				    "searchDomain": {
+							"savedQueries": [
+								{ "id": "2", "name": "logins", "displayName": "Logins", "query": { "queryString": "#event=login" } },
+								{ "id": "1", "name": "errors", "displayName": "Errors", "query": { "queryString": "loglevel=ERROR" } }
+							]
+						}
+				  }
+			}`
+			fmt.Fprint(w, listRes) //nolint:errcheck
+		})
+
+		r, err := testClient.ListSavedSearches("repo")
+		require.Nil(t, err)
+		require.Len(t, r, 2)
+		require.Equal(t, "errors", r[0].Name)
+		require.Equal(t, "loglevel=ERROR", r[0].QueryString)
+	})
+
 	t.Run("it adds the token as the auth header if ForwardHTTPHeaders is false", func(t *testing.T) {
 		setupClientTest(false)
 		defer teardownClientTest()
@@ -127,6 +215,133 @@ func TestClient(t *testing.T) {
 		}
 	})
 
+	t.Run("it ends a stream that stalls", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testClient.StreamStallTimeout = 100 * time.Millisecond
+		testMux.HandleFunc("/api/v1/repositories/repo/query", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-req.Context().Done()
+		})
+
+		err := testClient.Stream(context.Background(), http.MethodPost, "api/v1/repositories/repo/query", humio.Query{LSQL: "test query"}, make(chan humio.StreamingResults))
+		require.ErrorIs(t, err, humio.ErrStreamStalled)
+	})
+
+	t.Run("it does not count waiting for a slow consumer as a stall", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testClient.StreamStallTimeout = 100 * time.Millisecond
+		testMux.HandleFunc("/api/v1/repositories/repo/query", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, `{"@id": "a"}`) //nolint:errcheck
+			w.(http.Flusher).Flush()
+			// heartbeats keep the quiet stream alive
+			ticker := time.NewTicker(20 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-req.Context().Done():
+					return
+				case <-ticker.C:
+					fmt.Fprintln(w) //nolint:errcheck
+					w.(http.Flusher).Flush()
+				}
+			}
+		})
+
+		ch := make(chan humio.StreamingResults)
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error, 1)
+		go func() {
+			errs <- testClient.Stream(ctx, http.MethodPost, "api/v1/repositories/repo/query", humio.Query{LSQL: "test query"}, ch)
+		}()
+
+		// the consumer takes longer than the stall timeout to read the event
+		time.Sleep(300 * time.Millisecond)
+		require.Equal(t, "a", (<-ch)["@id"])
+		time.Sleep(150 * time.Millisecond)
+		cancel()
+		require.NoError(t, <-errs)
+	})
+
+	t.Run("it ingests events with the ingest token", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/api/v1/ingest/humio-structured", func(w http.ResponseWriter, req *http.Request) {
+			testMethod(t, req, http.MethodPost)
+			require.Equal(t, "Bearer ingest-token", req.Header.Get("Authorization"))
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, `[{"tags":{"source":"grafana"},"events":[{"attributes":{"status":"acknowledged"},"rawstring":"acknowledged by admin"}]}]`, string(body))
+			fmt.Fprint(w, "{}") //nolint:errcheck
+		})
+
+		err := testClient.Ingest(context.Background(), "ingest-token", []humio.IngestBatch{{
+			Tags:   map[string]string{"source": "grafana"},
+			Events: []humio.IngestEvent{{Attributes: map[string]any{"status": "acknowledged"}, RawString: "acknowledged by admin"}},
+		}})
+		require.NoError(t, err)
+	})
+
+	t.Run("it returns an APIError when ingest fails", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/api/v1/ingest/humio-structured", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		err := testClient.Ingest(context.Background(), "bad-token", []humio.IngestBatch{{Events: []humio.IngestEvent{{RawString: "a"}}}})
+		require.ErrorIs(t, err, humio.ErrUnauthorized)
+	})
+
+	t.Run("it returns an APIError with the LogScale detail", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/api/v1/repositories/repo/queryjobs", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":"QuerySyntaxError","detail":" Unknown function: foo "}`) //nolint:errcheck
+		})
+
+		_, err := testClient.CreateJob("repo", humio.Query{})
+		var apiErr *humio.APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		require.Equal(t, "QuerySyntaxError", apiErr.Code)
+		require.Equal(t, "Unknown function: foo", apiErr.Detail)
+		require.Equal(t, "api/v1/repositories/repo/queryjobs", apiErr.Path)
+		require.ErrorIs(t, err, humio.ErrBadRequest)
+		require.False(t, apiErr.Retryable())
+	})
+
+	t.Run("it returns a plain text error body as the detail", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/api/v1/repositories/repo/queryjobs/testid", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "cluster is starting") //nolint:errcheck
+		})
+
+		_, err := testClient.PollJob("repo", "testid")
+		var apiErr *humio.APIError
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, "cluster is starting", apiErr.Detail)
+		require.ErrorIs(t, err, humio.ErrServer)
+		require.True(t, apiErr.Retryable())
+	})
+
+	t.Run("it returns an APIError when GraphQL requests fail", func(t *testing.T) {
+		setupClientTest(false)
+		defer teardownClientTest()
+		testMux.HandleFunc("/graphql", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		_, err := testClient.ListRepos()
+		require.ErrorIs(t, err, humio.ErrUnauthorized)
+	})
+
 	t.Run("will error if passed expired jwts", func(t *testing.T) {
 		setupClientTest(true)
 		defer teardownClientTest()
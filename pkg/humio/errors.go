@@ -0,0 +1,114 @@
+package humio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hasura/go-graphql-client"
+)
+
+// Sentinel errors that an APIError matches with errors.Is, so callers can
+// branch on the kind of failure without inspecting status codes. They match
+// the status alone: a 404 may be a missing repository, query job or API, and a
+// 400 anything LogScale rejects, so the message is in the APIError.
+var (
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrBadRequest    = errors.New("bad request")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrServer        = errors.New("server error")
+)
+
+// APIError is returned by the Client when LogScale answers a request with a
+// non-success status.
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Code is the LogScale error code, if the response body carried one.
+	Code   string
+	Detail string
+	Method string
+	Path   string
+}
+
+func (e *APIError) Error() string {
+	status := e.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Detail == "" {
+		return status
+	}
+	return fmt.Sprintf("%s %s", status, e.Detail)
+}
+
+// Is reports whether the error matches one of the sentinel errors above.
+func (e *APIError) Is(target error) bool {
+	return e.kind() == target
+}
+
+// Retryable reports whether the same request may succeed if sent again later.
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (e *APIError) kind() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrQuotaExceeded
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+	return nil
+}
+
+func newAPIError(res *http.Response, method string, path string, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Method:     method,
+		Path:       path,
+	}
+	var errResponse ErrorResponse
+	if err := json.Unmarshal(body, &errResponse); err == nil && (errResponse.Detail != "" || errResponse.Code != "") {
+		apiErr.Code = errResponse.Code
+		apiErr.Detail = strings.TrimSpace(errResponse.Detail)
+		return apiErr
+	}
+	apiErr.Detail = strings.TrimSpace(string(body))
+	return apiErr
+}
+
+// graphQLAPIError converts an HTTP level failure reported by the GraphQL
+// client into an APIError. Other errors are returned unchanged.
+func graphQLAPIError(err error) error {
+	var networkErr graphql.NetworkError
+	if !errors.As(err, &networkErr) {
+		return err
+	}
+	return &APIError{
+		StatusCode: networkErr.StatusCode(),
+		Detail:     strings.TrimSpace(networkErr.Body()),
+		Method:     http.MethodPost,
+		Path:       "graphql",
+	}
+}
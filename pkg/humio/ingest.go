@@ -0,0 +1,70 @@
+package humio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+const ingestPath = "api/v1/ingest/humio-structured"
+
+// IngestEvent is an event written to LogScale. Timestamp is an ISO 8601 time
+// or milliseconds since the epoch, LogScale uses the time of ingest when it is
+// empty.
+type IngestEvent struct {
+	Timestamp  any            `json:"timestamp,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	RawString  string         `json:"rawstring,omitempty"`
+}
+
+// IngestBatch is a group of events that share the same tags.
+type IngestBatch struct {
+	Tags   map[string]string `json:"tags,omitempty"`
+	Events []IngestEvent     `json:"events"`
+}
+
+// Ingest writes the batches to the repository of the ingest token in a single
+// request. The ingest token is sent instead of the credentials of the client.
+func (c *Client) Ingest(ctx context.Context, token string, batches []IngestBatch) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(batches); err != nil {
+		return backend.PluginError(err)
+	}
+
+	u, err := url.JoinPath(c.URL.String(), ingestPath)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := res.Body.Close()
+		if err != nil {
+			backend.Logger.Warn("failed to close response body: %s", err.Error())
+		}
+	}()
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	errBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return &APIError{StatusCode: res.StatusCode, Status: res.Status, Detail: "failed to read response body", Method: http.MethodPost, Path: ingestPath}
+	}
+	return newAPIError(res, http.MethodPost, ingestPath, errBody)
+}
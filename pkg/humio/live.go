@@ -0,0 +1,146 @@
+package humio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// defaultLiveAggregateStart is the window of a live aggregate query that does
+// not set a start.
+const defaultLiveAggregateStart = "5m"
+
+// minLivePollInterval keeps a live job from being polled in a busy loop when
+// LogScale does not ask for a delay.
+const minLivePollInterval = 500 * time.Millisecond
+
+// errLiveJobExpired is returned when a live job is no longer found, which
+// happens when LogScale stops it after it was not polled in time.
+var errLiveJobExpired = errors.New("live query job expired")
+
+// RunLiveAggregate keeps a live query job running until ctx is done and sends
+// its result to c every time it changes. The job is polled as often as
+// LogScale asks for with pollAfter. When polling fails, for example because the
+// job expired, a new job is created with backoff. Changes in the connection are
+// reported to status when status is not nil.
+func (qr *QueryRunner) RunLiveAggregate(ctx context.Context, query Query, c chan<- QueryResult, status chan<- StreamStatus) {
+	ctx, stop := qr.track(ctx)
+	go func() {
+		defer stop()
+		err := qr.liveAggregate(ctx, query, c, status)
+		if err != nil {
+			log.DefaultLogger.Error(err.Error())
+		}
+	}()
+}
+
+func (qr *QueryRunner) liveAggregate(ctx context.Context, query Query, c chan<- QueryResult, status chan<- StreamStatus) error {
+	query.IsLive = true
+	if query.Start == "" {
+		query.Start = defaultLiveAggregateStart
+	}
+	report := func(s StreamStatus) {
+		if status == nil {
+			return
+		}
+		select {
+		case status <- s:
+		case <-ctx.Done():
+		}
+	}
+
+	repository, err := query.SingleRepository()
+	if err != nil {
+		err = backend.DownstreamError(fmt.Errorf("live query: %w", err))
+		report(StreamStatus{State: StreamStateFailed, Err: err})
+		return err
+	}
+	query.Repository = repository
+
+	backoff := streamInitialBackoff
+	attempt := 0
+	var last *QueryResult
+	for {
+		err := qr.pollLiveJob(ctx, query, func(r QueryResult) bool {
+			if attempt > 0 {
+				report(StreamStatus{State: StreamStateConnected, Attempt: attempt})
+				attempt = 0
+				backoff = streamInitialBackoff
+			}
+			if last != nil && sameResult(*last, r) {
+				return true
+			}
+			last = &r
+			select {
+			case c <- humioToDatasourceResult(r):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if permanentStreamError(err) {
+			report(StreamStatus{State: StreamStateFailed, Attempt: attempt, Err: err})
+			return err
+		}
+
+		attempt++
+		report(StreamStatus{State: StreamStateReconnecting, Attempt: attempt, Err: fmt.Errorf("live query job failed: %w", err)})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+	}
+}
+
+// pollLiveJob creates a live job and passes every polled result to send until
+// send returns false, ctx is done or polling fails. The job is deleted once
+// polling stops.
+func (qr *QueryRunner) pollLiveJob(ctx context.Context, query Query, send func(QueryResult) bool) error {
+	id, err := qr.createJob(query.Repository, query)
+	if err != nil {
+		return err
+	}
+	// live jobs keep running until they are deleted or expire after not being polled
+	defer qr.deleteJob(query.Repository, id)
+
+	poller := QueryJobPoller{
+		QueryJobs:  &qr.JobQuerier,
+		Repository: query.Repository,
+		Id:         id,
+	}
+	for {
+		result, err := poller.WaitAndPollContext(ctx)
+		if errors.Is(err, ErrNotFound) {
+			return errLiveJobExpired
+		}
+		if err != nil {
+			return err
+		}
+		if next := time.Now().Add(minLivePollInterval); poller.NextPoll.Before(next) {
+			poller.NextPoll = next
+		}
+		if !send(result) {
+			return ctx.Err()
+		}
+	}
+}
+
+// sameResult reports whether a poll returned the same events and fields as the
+// previous one, so unchanged aggregates are not sent again.
+func sameResult(a, b QueryResult) bool {
+	return reflect.DeepEqual(a.Events, b.Events) && reflect.DeepEqual(a.Metadata.FieldOrder, b.Metadata.FieldOrder)
+}
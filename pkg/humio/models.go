@@ -1,5 +1,11 @@
 package humio
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 type Query struct {
 	Repository     string `json:"repository"`
 	LSQL           string `json:"lsql"`
@@ -8,21 +14,94 @@ type Query struct {
 	TimezoneOffset *int   `json:"timeZoneOffsetMinutes,omitempty"`
 	FormatAs       string `json:"formatAs"`
 	QueryType      string `json:"queryType,omitempty"`
+	// SavedSearch is the name of the saved search run by SavedSearch queries
+	SavedSearch string `json:"savedSearch,omitempty"`
+	// AutoSpan injects the panel interval as span into timeChart and bucket calls without one
+	AutoSpan bool `json:"autoSpan,omitempty"`
+	// RepositoryType filters Repositories queries to repositories or views
+	RepositoryType string `json:"repositoryType,omitempty"`
+	// Arguments are passed to LogScale as values for query parameters
+	Arguments map[string]string `json:"arguments,omitempty"`
+	// NodeGraph maps result fields to nodes and edges for the nodeGraph format
+	NodeGraph NodeGraphOptions `json:"nodeGraph,omitempty"`
+	// Variable selects the text and value fields of template variable options
+	Variable VariableOptions `json:"variable,omitempty"`
+	// TraceID is the trace looked up by TraceID queries
+	TraceID string `json:"traceId,omitempty"`
+	// LiveMode selects how a live query is streamed, see LiveModeTail and LiveModeAggregate
+	LiveMode string `json:"liveMode,omitempty"`
+	// IsLive creates the query job as a live job that is kept running
+	IsLive bool `json:"-"`
 
 	// This is the version of the plugin that the query was created/updated with
 	// Needed for tracking query versions across migrations
 	Version string `json:"version,omitempty"`
 }
 
+// Repositories returns the repositories of the query. Repository may hold a
+// comma separated list, optionally wrapped in braces as produced by multi-value
+// template variables.
+func (q Query) Repositories() []string {
+	repository := strings.TrimSpace(q.Repository)
+	if strings.HasPrefix(repository, "{") && strings.HasSuffix(repository, "}") {
+		repository = repository[1 : len(repository)-1]
+	}
+	var repositories []string
+	for _, r := range strings.Split(repository, ",") {
+		r = strings.TrimSpace(r)
+		if r != "" && !slices.Contains(repositories, r) {
+			repositories = append(repositories, r)
+		}
+	}
+	return repositories
+}
+
+// RepositoryField is added to events of multi-repository queries. LogScale
+// reserves the @ prefix for its built-in fields and has no @repository, so the
+// field does not collide with a repository field of the events.
+const RepositoryField = "@repository"
+
+// SingleRepository returns the repository of queries that run against exactly
+// one repository, such as live queries and saved searches.
+func (q Query) SingleRepository() (string, error) {
+	repositories := q.Repositories()
+	if len(repositories) != 1 {
+		return "", fmt.Errorf("the query needs exactly one repository, got %d", len(repositories))
+	}
+	return repositories[0], nil
+}
+
 const (
-	QueryTypeLQL          = "LQL"
-	QueryTypeRepositories = "Repositories"
+	QueryTypeLQL                = "LQL"
+	QueryTypeRepositories       = "Repositories"
+	QueryTypeSavedSearch        = "SavedSearch"
+	QueryTypeRepositoryMetadata = "RepositoryMetadata"
+	QueryTypeTraceID            = "TraceID"
 )
 
 const (
 	FormatMetrics  = "metrics"
 	FormatLogs     = "logs"
 	FormatVariable = "variable"
+	// FormatTable keeps the field order and shape of the LogScale results
+	FormatTable = "table"
+	// FormatTimeSeriesLong returns bucketed results without pivoting them to wide
+	FormatTimeSeriesLong = "timeseries-long"
+	// FormatHeatmap returns value buckets over time as a heatmap
+	FormatHeatmap = "heatmap"
+	// FormatGeomap returns locations from ipLocation() or worldMap() for the Geomap panel
+	FormatGeomap = "geomap"
+	// FormatNodeGraph returns source and target fields as node graph nodes and edges
+	FormatNodeGraph = "nodeGraph"
+	// FormatTrace returns span events as a trace for the trace view
+	FormatTrace = "trace"
+)
+
+const (
+	// LiveModeTail streams every new event of the query
+	LiveModeTail = "tail"
+	// LiveModeAggregate keeps a live query job running and streams its refreshed result
+	LiveModeAggregate = "aggregate"
 )
 
 type QueryResult struct {
@@ -30,6 +109,8 @@ type QueryResult struct {
 	Done      bool                `json:"done"`
 	Events    []map[string]any    `json:"events"`
 	Metadata  QueryResultMetadata `json:"metaData"`
+	// Repository is set on results of multi-repository queries
+	Repository string `json:"-"`
 }
 
 type StreamingResults map[string]any
@@ -49,3 +130,65 @@ type QueryResultMetadata struct {
 	TotalWork        uint64                 `json:"totalWork"`
 	WorkDone         uint64                 `json:"workDone"`
 }
+
+type SavedSearch struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	QueryString string `json:"queryString"`
+}
+
+const (
+	SearchDomainTypeRepository = "repository"
+	SearchDomainTypeView       = "view"
+)
+
+// SearchDomain is a repository or a view. Views list the repositories they
+// read from along with the filter applied to each of them.
+type SearchDomain struct {
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Connections []ViewConnection `json:"connections,omitempty"`
+}
+
+type ViewConnection struct {
+	Repository string `json:"repository"`
+	Filter     string `json:"filter,omitempty"`
+}
+
+// NodeGraphOptions names the fields used to build a node graph. Each event is
+// an edge from SourceField to TargetField, and TitleField, SubtitleField and
+// MetricField describe the target node. Fields left empty are detected from
+// the results.
+type NodeGraphOptions struct {
+	SourceField   string `json:"sourceField,omitempty"`
+	TargetField   string `json:"targetField,omitempty"`
+	TitleField    string `json:"titleField,omitempty"`
+	SubtitleField string `json:"subtitleField,omitempty"`
+	MetricField   string `json:"metricField,omitempty"`
+}
+
+// VariableOptions names the fields holding the display text and value of
+// template variable options, and optionally a regex the text has to match.
+type VariableOptions struct {
+	TextField  string `json:"textField,omitempty"`
+	ValueField string `json:"valueField,omitempty"`
+	Regex      string `json:"regex,omitempty"`
+}
+
+// RepositoryMetadata describes a repository or view. Retention and size
+// statistics are only reported for repositories.
+type RepositoryMetadata struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	// TimeBasedRetention is the retention in days
+	TimeBasedRetention *float64 `json:"timeBasedRetention,omitempty"`
+	// IngestSizeBasedRetention is the retention by ingested size in GB
+	IngestSizeBasedRetention *float64 `json:"ingestSizeBasedRetention,omitempty"`
+	// StorageSizeBasedRetention is the retention by stored size in GB
+	StorageSizeBasedRetention *float64 `json:"storageSizeBasedRetention,omitempty"`
+	CompressedByteSize        *int64   `json:"compressedByteSize,omitempty"`
+	UncompressedByteSize      *int64   `json:"uncompressedByteSize,omitempty"`
+}
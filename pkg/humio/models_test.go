@@ -0,0 +1,27 @@
+package humio_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryRepositories(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		expected   []string
+	}{
+		{name: "single repository", repository: "repo", expected: []string{"repo"}},
+		{name: "empty repository", repository: "", expected: nil},
+		{name: "comma separated", repository: "repo1, repo2", expected: []string{"repo1", "repo2"}},
+		{name: "multi-value variable", repository: "{repo1,repo2,repo1}", expected: []string{"repo1", "repo2"}},
+		{name: "empty braces", repository: "{}", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, humio.Query{Repository: tt.repository}.Repositories())
+		})
+	}
+}
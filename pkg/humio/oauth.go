@@ -59,7 +59,13 @@ func (c *Client) fetchOAuth2Token() error {
 				return nil, err
 			}
 			log.DefaultLogger.Error("OAuth2 token request failed", "status", resp.Status, "body", errBody.String())
-			return nil, fmt.Errorf("oauth2 token request failed with status: %s", resp.Status)
+			return nil, &APIError{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+				Detail:     "oauth2 token request failed",
+				Method:     http.MethodPost,
+				Path:       "oauth2/token",
+			}
 		}
 
 		var tokenResp OAuth2TokenResponse
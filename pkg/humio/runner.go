@@ -2,10 +2,13 @@ package humio
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,21 +21,44 @@ type JobQuerier interface {
 	DeleteJob(repo string, id string) error
 	PollJob(repo string, id string) (QueryResult, error)
 	ListRepos() ([]string, error)
+	ListSearchDomains() ([]SearchDomain, error)
+	ListSavedSearches(repo string) ([]SavedSearch, error)
+	ListRepoMetadata() ([]RepositoryMetadata, error)
 	SetAuthHeaders(headers map[string]string) error
 	Stream(ctx context.Context, method string, path string, query Query, ch chan StreamingResults) error
 	OauthClientSecretHealthCheck() error
 }
 
+// maxConcurrentJobs limits how many query jobs a multi-repository query runs at once
+const maxConcurrentJobs = 8
+
 type QueryRunner struct {
 	JobQuerier JobQuerier
+
+	// ctx is cancelled by Close to stop every job and stream of the runner
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	jobs   map[runningJob]struct{}
+	active sync.WaitGroup
+}
+
+// runningJob is a query job that has not been deleted yet.
+type runningJob struct {
+	repository string
+	id         string
 }
 
 // QueryRunnerOption acts as an optional modifier on the QueryRunner
 type QueryRunnerOption func(qr *QueryRunner)
 
 func NewQueryRunner(c JobQuerier, opts ...QueryRunnerOption) *QueryRunner {
+	ctx, cancel := context.WithCancel(context.Background())
 	qr := &QueryRunner{
 		JobQuerier: c,
+		ctx:        ctx,
+		cancel:     cancel,
+		jobs:       map[runningJob]struct{}{},
 	}
 
 	for _, o := range opts {
@@ -43,68 +69,301 @@ func NewQueryRunner(c JobQuerier, opts ...QueryRunnerOption) *QueryRunner {
 }
 
 func (qj *QueryRunner) Run(query Query) ([]QueryResult, error) {
+	ctx, cancel := context.WithCancel(qj.ctx)
+	defer cancel()
+	ctx = contextCancelledOnInterrupt(ctx)
+
 	repository := query.Repository
+	repositories := query.Repositories()
+	switch {
+	case len(repositories) > 1:
+		return qj.runRepositories(ctx, repositories, query)
+	case len(repositories) == 1:
+		repository = repositories[0]
+	}
 
-	ctx := contextCancelledOnInterrupt(context.Background())
-	// run in lambda func to be able to defer and delete the query job
-	result, err := func() (*QueryResult, error) {
-		id, err := qj.JobQuerier.CreateJob(repository, query)
+	result, err := qj.runJob(ctx, repository, query)
+	if err != nil {
+		log.DefaultLogger.Error("Humio query string error: %s\n", err.Error())
+		return nil, backend.DownstreamError(err)
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	r := humioToDatasourceResult(*result)
+	return []QueryResult{r}, nil
+}
 
-		defer func(id string) {
-			// Humio will eventually delete the query when we stop polling and we can't do much about errors here.
-			_ = qj.JobQuerier.DeleteJob(repository, id)
-		}(id)
+// runRepositories runs the query against every repository concurrently and
+// merges the results into one, tagging each event with its repository. Failed
+// repositories are returned as RepositoryErrors alongside the merged result as
+// long as at least one repository succeeded.
+func (qj *QueryRunner) runRepositories(ctx context.Context, repositories []string, query Query) ([]QueryResult, error) {
+	results := make([]*QueryResult, len(repositories))
+	errs := make([]error, len(repositories))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentJobs)
+	for i, repo := range repositories {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			q := query
+			q.Repository = repo
+			result, err := qj.runJob(ctx, repo, q)
+			if err != nil {
+				log.DefaultLogger.Error("Humio query string error", "repository", repo, "error", err.Error())
+				errs[i] = &RepositoryError{Repository: repo, Err: err}
+				return
+			}
+			r := humioToDatasourceResult(*result)
+			r.Repository = repo
+			results[i] = &r
+		}()
+	}
+	wg.Wait()
 
-		var result QueryResult
-		poller := QueryJobPoller{
-			QueryJobs:  &qj.JobQuerier,
-			Repository: repository,
-			Id:         id,
+	var succeeded []QueryResult
+	for _, r := range results {
+		if r != nil {
+			succeeded = append(succeeded, *r)
 		}
-		result, err = poller.WaitAndPollContext(ctx)
+	}
+	err := errors.Join(errs...)
+	if len(succeeded) == 0 {
+		return nil, backend.DownstreamError(err)
+	}
+
+	return []QueryResult{mergeResults(succeeded)}, err
+}
 
+// runJob creates a query job and polls it until it is done. The job is deleted
+// once polling stops.
+func (qj *QueryRunner) runJob(ctx context.Context, repository string, query Query) (*QueryResult, error) {
+	if !qj.begin() {
+		return nil, context.Canceled
+	}
+	defer qj.active.Done()
+
+	id, err := qj.createJob(repository, query)
+	if err != nil {
+		return nil, err
+	}
+	defer qj.deleteJob(repository, id)
+
+	var result QueryResult
+	poller := QueryJobPoller{
+		QueryJobs:  &qj.JobQuerier,
+		Repository: repository,
+		Id:         id,
+	}
+	result, err = poller.WaitAndPollContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for !result.Done {
+		result, err = poller.WaitAndPollContext(ctx)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		for !result.Done {
-			result, err = poller.WaitAndPollContext(ctx)
-			if err != nil {
-				return nil, err
+	return &result, nil
+}
+
+// mergeResults concatenates the events of results from different repositories
+// and adds a repository field to each event.
+func mergeResults(results []QueryResult) QueryResult {
+	merged := QueryResult{Done: true, Events: []map[string]any{}}
+	seenFields := map[string]bool{}
+	for _, r := range results {
+		merged.Cancelled = merged.Cancelled || r.Cancelled
+		merged.Done = merged.Done && r.Done
+		merged.Metadata.IsAggregate = merged.Metadata.IsAggregate || r.Metadata.IsAggregate
+		merged.Metadata.EventCount += r.Metadata.EventCount
+		merged.Metadata.ProcessedBytes += r.Metadata.ProcessedBytes
+		merged.Metadata.ProcessedEvents += r.Metadata.ProcessedEvents
+		for _, field := range r.Metadata.FieldOrder {
+			if !seenFields[field] {
+				seenFields[field] = true
+				merged.Metadata.FieldOrder = append(merged.Metadata.FieldOrder, field)
+			}
+		}
+		for _, event := range r.Events {
+			e := make(map[string]any, len(event)+1)
+			for k, v := range event {
+				e[k] = v
 			}
+			e[RepositoryField] = r.Repository
+			merged.Events = append(merged.Events, e)
 		}
+	}
+	if len(merged.Metadata.FieldOrder) > 0 && !seenFields[RepositoryField] {
+		merged.Metadata.FieldOrder = append(merged.Metadata.FieldOrder, RepositoryField)
+	}
+	return merged
+}
 
-		return &result, nil
+// RunChannel streams the results of a live query into c until ctx is done. The
+// stream reconnects when it drops or stalls, and reports changes in its
+// connection to status when status is not nil.
+func (qr *QueryRunner) RunChannel(ctx context.Context, query Query, c chan StreamingResults, status chan<- StreamStatus) {
+	repository, err := query.SingleRepository()
+	if err != nil {
+		reportFailed(ctx, status, backend.DownstreamError(fmt.Errorf("live query: %w", err)))
+		return
+	}
+	endPoint := fmt.Sprintf("api/v1/repositories/%s/query", url.PathEscape(repository))
+	ctx, stop := qr.track(ctx)
+	go func() {
+		defer stop()
+		err := qr.streamWithReconnect(ctx, endPoint, http.MethodPost, query, c, status)
+		if err != nil {
+			log.DefaultLogger.Error(err.Error())
+			return
+		}
 	}()
+}
 
+// reportFailed logs err for a stream that cannot start and reports it to
+// status when status is not nil.
+func reportFailed(ctx context.Context, status chan<- StreamStatus, err error) {
+	log.DefaultLogger.Error(err.Error())
+	if status == nil {
+		return
+	}
+	go func() {
+		select {
+		case status <- StreamStatus{State: StreamStateFailed, Err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// createJob creates a query job and tracks it until deleteJob, so Close can
+// delete the jobs that are still running.
+func (qr *QueryRunner) createJob(repository string, query Query) (string, error) {
+	id, err := qr.JobQuerier.CreateJob(repository, query)
 	if err != nil {
-		log.DefaultLogger.Error("Humio query string error: %s\n", err.Error())
-		return nil, backend.DownstreamError(err)
+		return "", err
 	}
+	qr.mu.Lock()
+	qr.jobs[runningJob{repository: repository, id: id}] = struct{}{}
+	qr.mu.Unlock()
+	return id, nil
+}
 
-	r := humioToDatasourceResult(*result)
-	return []QueryResult{r}, nil
+func (qr *QueryRunner) deleteJob(repository string, id string) {
+	job := runningJob{repository: repository, id: id}
+	qr.mu.Lock()
+	_, ok := qr.jobs[job]
+	delete(qr.jobs, job)
+	qr.mu.Unlock()
+	if ok {
+		// Humio will eventually delete the query when we stop polling and we can't do much about errors here.
+		_ = qr.JobQuerier.DeleteJob(repository, id)
+	}
 }
 
-func (qr *QueryRunner) RunChannel(ctx context.Context, query Query, c chan StreamingResults) {
-	endPoint := fmt.Sprintf("api/v1/repositories/%s/query", query.Repository)
+// track returns a context for a stream of the runner that is also cancelled
+// by Close. The stream must call the returned func once it has stopped.
+func (qr *QueryRunner) track(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if !qr.begin() {
+		cancel()
+		return ctx, func() {}
+	}
+	stopAfter := context.AfterFunc(qr.ctx, cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+		qr.active.Done()
+	}
+}
+
+// begin counts a query or stream as active unless the runner is closed.
+func (qr *QueryRunner) begin() bool {
+	qr.mu.Lock()
+	defer qr.mu.Unlock()
+	if qr.ctx.Err() != nil {
+		return false
+	}
+	qr.active.Add(1)
+	return true
+}
+
+// Close cancels the queries and streams of the runner and waits for them to
+// stop until ctx is done. Query jobs that are still running after that are
+// deleted.
+func (qr *QueryRunner) Close(ctx context.Context) error {
+	qr.mu.Lock()
+	qr.cancel()
+	qr.mu.Unlock()
+
+	stopped := make(chan struct{})
 	go func() {
-		err := qr.JobQuerier.Stream(ctx, http.MethodPost, endPoint, query, c)
-		if err != nil {
-			log.DefaultLogger.Error(err.Error())
-			return
-		}
+		qr.active.Wait()
+		close(stopped)
 	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	qr.mu.Lock()
+	jobs := make([]runningJob, 0, len(qr.jobs))
+	for job := range qr.jobs {
+		jobs = append(jobs, job)
+	}
+	qr.mu.Unlock()
+	for _, job := range jobs {
+		qr.deleteJob(job.repository, job.id)
+	}
+	return err
 }
 
 func (qr *QueryRunner) GetAllRepoNames() ([]string, error) {
 	return qr.JobQuerier.ListRepos()
 }
 
+func (qr *QueryRunner) GetSearchDomains() ([]SearchDomain, error) {
+	return qr.JobQuerier.ListSearchDomains()
+}
+
+func (qr *QueryRunner) GetRepoMetadata() ([]RepositoryMetadata, error) {
+	return qr.JobQuerier.ListRepoMetadata()
+}
+
+func (qr *QueryRunner) GetSavedSearches(repo string) ([]SavedSearch, error) {
+	return qr.JobQuerier.ListSavedSearches(repo)
+}
+
+// ResolveSavedSearch looks up the saved search named by the query and returns
+// the query with its LQL replaced by the saved query string.
+func (qr *QueryRunner) ResolveSavedSearch(query Query) (Query, error) {
+	// a saved search belongs to a single repository
+	repository, err := query.SingleRepository()
+	if err != nil {
+		return query, backend.DownstreamError(fmt.Errorf("saved search %q: %w", query.SavedSearch, err))
+	}
+	searches, err := qr.JobQuerier.ListSavedSearches(repository)
+	if err != nil {
+		return query, err
+	}
+	for _, s := range searches {
+		if s.Name == query.SavedSearch {
+			query.LSQL = s.QueryString
+			return query, nil
+		}
+	}
+	return query, backend.DownstreamError(fmt.Errorf("saved search %q not found in %s", query.SavedSearch, repository))
+}
+
 func (qr *QueryRunner) SetAuthHeaders(authHeaders map[string]string) error {
 	return qr.JobQuerier.SetAuthHeaders(authHeaders)
 }
@@ -113,11 +372,26 @@ func (qr *QueryRunner) OauthClientSecretHealthCheck() error {
 	return qr.JobQuerier.OauthClientSecretHealthCheck()
 }
 
+// RepositoryError is the error of a single repository in a multi-repository query.
+type RepositoryError struct {
+	Repository string
+	Err        error
+}
+
+func (e *RepositoryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Repository, e.Err.Error())
+}
+
+func (e *RepositoryError) Unwrap() error {
+	return e.Err
+}
+
 func humioToDatasourceResult(r QueryResult) QueryResult {
 	return QueryResult{
 		Cancelled: r.Cancelled,
 		Done:      r.Done,
 		Events:    r.Events,
+		Metadata:  r.Metadata,
 	}
 }
 
@@ -152,8 +426,12 @@ func contextCancelledOnInterrupt(ctx context.Context) context.Context {
 	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		<-sigC
-		cancel()
+		defer signal.Stop(sigC)
+		select {
+		case <-sigC:
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
 	return ctx
@@ -2,9 +2,14 @@ package humio_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,6 +22,28 @@ func TestRunner(t *testing.T) {
 		require.Nil(t, err)
 		require.Equal(t, testResult, r[0])
 	})
+	t.Run("it merges results from multiple repositories", func(t *testing.T) {
+		testResult := humio.QueryResult{Done: true, Events: []map[string]any{{"field": "value", "repository": "own"}}}
+		jq := TestJobQuerier{id: "testId", queryResult: testResult, createErrs: map[string]error{"repo2": errors.New("not found")}}
+		qr := humio.NewQueryRunner(jq)
+		r, err := qr.Run(humio.Query{Repository: "{repo1,repo2,repo3}"})
+		require.Len(t, r, 1)
+		require.Equal(t, []map[string]any{
+			{"field": "value", "repository": "own", "@repository": "repo1"},
+			{"field": "value", "repository": "own", "@repository": "repo3"},
+		}, r[0].Events)
+
+		var repoErr *humio.RepositoryError
+		require.ErrorAs(t, err, &repoErr)
+		require.Equal(t, "repo2", repoErr.Repository)
+	})
+	t.Run("it returns an error when every repository fails", func(t *testing.T) {
+		jq := TestJobQuerier{createErrs: map[string]error{"repo1": errors.New("not found"), "repo2": errors.New("not found")}}
+		qr := humio.NewQueryRunner(jq)
+		r, err := qr.Run(humio.Query{Repository: "repo1,repo2"})
+		require.Error(t, err)
+		require.Nil(t, r)
+	})
 	t.Run("it returns repos", func(t *testing.T) {
 		repos := []string{"repo1", "repo2"}
 		jq := TestJobQuerier{repos: repos}
@@ -25,23 +52,328 @@ func TestRunner(t *testing.T) {
 		require.Nil(t, err)
 		require.Equal(t, repos, r)
 	})
+	t.Run("it resolves a saved search to its query string", func(t *testing.T) {
+		jq := TestJobQuerier{searches: []humio.SavedSearch{
+			{Name: "failed-logins", QueryString: "#event=login | status=failed"},
+		}}
+		qr := humio.NewQueryRunner(jq)
+		q, err := qr.ResolveSavedSearch(humio.Query{Repository: "repo", SavedSearch: "failed-logins"})
+		require.Nil(t, err)
+		require.Equal(t, "#event=login | status=failed", q.LSQL)
+
+		_, err = qr.ResolveSavedSearch(humio.Query{Repository: "repo", SavedSearch: "missing"})
+		require.Error(t, err)
+	})
+	t.Run("it resolves saved searches in exactly one repository", func(t *testing.T) {
+		jq := TestJobQuerier{searches: []humio.SavedSearch{
+			{Name: "failed-logins", QueryString: "#event=login | status=failed"},
+		}}
+		qr := humio.NewQueryRunner(jq)
+		q, err := qr.ResolveSavedSearch(humio.Query{Repository: "{repo}", SavedSearch: "failed-logins"})
+		require.Nil(t, err)
+		require.Equal(t, "#event=login | status=failed", q.LSQL)
+
+		_, err = qr.ResolveSavedSearch(humio.Query{Repository: "repo1,repo2", SavedSearch: "failed-logins"})
+		require.ErrorContains(t, err, "needs exactly one repository")
+		require.True(t, backend.IsDownstreamError(err))
+
+		_, err = qr.ResolveSavedSearch(humio.Query{SavedSearch: "failed-logins"})
+		require.True(t, backend.IsDownstreamError(err))
+	})
 	t.Run("it returns on a result on the channel", func(t *testing.T) {
 		repos := []string{"repo1", "repo2"}
-		q := humio.Query{}
+		q := humio.Query{Repository: "repo"}
 		jq := TestJobQuerier{repos: repos}
 		qr := humio.NewQueryRunner(jq)
 		c := make(chan humio.StreamingResults)
-		qr.RunChannel(context.Background(), q, c)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		qr.RunChannel(ctx, q, c, nil)
 		result := <-c
 		expected := humio.StreamingResults{}
 		require.Equal(t, expected, result)
 	})
+	t.Run("it reconnects a dropped stream and resumes after the last event", func(t *testing.T) {
+		jq := &reconnectingJobQuerier{
+			batches: [][]humio.StreamingResults{
+				{{"@id": "a", "@timestamp": "1000"}, {"@id": "b", "@timestamp": "2000"}},
+				{{"@id": "b", "@timestamp": "2000"}, {"@id": "c", "@timestamp": "3000"}},
+			},
+		}
+		qr := humio.NewQueryRunner(jq)
+		c := make(chan humio.StreamingResults)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunChannel(ctx, humio.Query{Repository: "repo"}, c, status)
+		var ids []any
+		for range 3 {
+			ids = append(ids, (<-c)["@id"])
+		}
+		require.Equal(t, []any{"a", "b", "c"}, ids)
+		require.Equal(t, []string{"", "2000"}, jq.starts)
+
+		reconnecting := <-status
+		require.Equal(t, humio.StreamStateReconnecting, reconnecting.State)
+		require.Equal(t, 1, reconnecting.Attempt)
+		require.Equal(t, humio.StreamStateConnected, (<-status).State)
+	})
+	t.Run("it stops reconnecting on permanent errors", func(t *testing.T) {
+		jq := &reconnectingJobQuerier{err: &humio.APIError{StatusCode: 401}}
+		qr := humio.NewQueryRunner(jq)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunChannel(ctx, humio.Query{Repository: "repo"}, make(chan humio.StreamingResults), status)
+		failed := <-status
+		require.Equal(t, humio.StreamStateFailed, failed.State)
+		require.ErrorIs(t, failed.Err, humio.ErrUnauthorized)
+		require.Equal(t, []string{"api/v1/repositories/repo/query"}, jq.paths)
+	})
+	t.Run("it escapes the repository of a live query", func(t *testing.T) {
+		jq := &reconnectingJobQuerier{err: &humio.APIError{StatusCode: 401}}
+		qr := humio.NewQueryRunner(jq)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunChannel(ctx, humio.Query{Repository: "{my repo}"}, make(chan humio.StreamingResults), status)
+		<-status
+		require.Equal(t, []string{"api/v1/repositories/my%20repo/query"}, jq.paths)
+	})
+	t.Run("it fails live queries of several repositories", func(t *testing.T) {
+		jq := &reconnectingJobQuerier{}
+		qr := humio.NewQueryRunner(jq)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunChannel(ctx, humio.Query{Repository: "repo1,repo2"}, make(chan humio.StreamingResults), status)
+		failed := <-status
+		require.Equal(t, humio.StreamStateFailed, failed.State)
+		require.ErrorContains(t, failed.Err, "needs exactly one repository")
+		require.True(t, backend.IsDownstreamError(failed.Err))
+		require.Empty(t, jq.paths)
+	})
+}
+
+func TestRunLiveAggregate(t *testing.T) {
+	first := humio.QueryResult{Events: []map[string]any{{"service": "api", "_count": "1"}}}
+	second := humio.QueryResult{Events: []map[string]any{{"service": "api", "_count": "2"}}}
+
+	t.Run("it sends changed results of a live job and recreates it when polling fails", func(t *testing.T) {
+		jq := &liveJobQuerier{polls: []liveJobPoll{
+			{result: first},
+			{result: first},
+			{err: &humio.APIError{StatusCode: 404}},
+			{result: second},
+		}}
+		qr := humio.NewQueryRunner(jq)
+		c := make(chan humio.QueryResult)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunLiveAggregate(ctx, humio.Query{Repository: "repo", LSQL: "groupBy(service)"}, c, status)
+		require.Equal(t, first.Events, (<-c).Events)
+		require.Equal(t, second.Events, (<-c).Events)
+
+		require.Equal(t, humio.StreamStateReconnecting, (<-status).State)
+		require.Equal(t, humio.StreamStateConnected, (<-status).State)
+
+		jq.mu.Lock()
+		defer jq.mu.Unlock()
+		require.Len(t, jq.created, 2)
+		require.True(t, jq.created[0].IsLive)
+		require.Equal(t, "5m", jq.created[0].Start)
+		require.Equal(t, []string{"job-1"}, jq.deleted)
+	})
+	t.Run("it stops on permanent errors", func(t *testing.T) {
+		jq := &liveJobQuerier{createErr: &humio.APIError{StatusCode: 403}}
+		qr := humio.NewQueryRunner(jq)
+		status := make(chan humio.StreamStatus, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		qr.RunLiveAggregate(ctx, humio.Query{Repository: "repo"}, make(chan humio.QueryResult), status)
+		failed := <-status
+		require.Equal(t, humio.StreamStateFailed, failed.State)
+		require.ErrorIs(t, failed.Err, humio.ErrForbidden)
+	})
+}
+
+func TestQueryRunnerClose(t *testing.T) {
+	t.Run("it cancels running queries and deletes their jobs", func(t *testing.T) {
+		jq := &blockingJobQuerier{polled: make(chan struct{}, 10)}
+		qr := humio.NewQueryRunner(jq)
+		errs := make(chan error)
+		go func() {
+			_, err := qr.Run(humio.Query{Repository: "repo"})
+			errs <- err
+		}()
+		<-jq.polled
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, qr.Close(ctx))
+		require.ErrorIs(t, <-errs, context.Canceled)
+		require.Equal(t, []string{"job"}, jq.Deleted())
+	})
+	t.Run("it stops streams", func(t *testing.T) {
+		qr := humio.NewQueryRunner(&reconnectingJobQuerier{})
+		qr.RunChannel(context.Background(), humio.Query{Repository: "repo"}, make(chan humio.StreamingResults), nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, qr.Close(ctx))
+	})
+	t.Run("it deletes jobs that are still running at the deadline", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+		jq := &blockingJobQuerier{polled: make(chan struct{}, 10), block: block}
+		qr := humio.NewQueryRunner(jq)
+		go qr.Run(humio.Query{Repository: "repo"}) //nolint:errcheck
+		<-jq.polled
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, qr.Close(ctx), context.DeadlineExceeded)
+		require.Equal(t, []string{"job"}, jq.Deleted())
+	})
+	t.Run("it does not start queries once closed", func(t *testing.T) {
+		jq := &blockingJobQuerier{polled: make(chan struct{}, 10)}
+		qr := humio.NewQueryRunner(jq)
+		require.NoError(t, qr.Close(context.Background()))
+
+		_, err := qr.Run(humio.Query{Repository: "repo"})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, jq.Deleted())
+	})
+}
+
+// blockingJobQuerier creates jobs that never finish. When block is set, polls
+// wait for it to be closed.
+type blockingJobQuerier struct {
+	TestJobQuerier
+	polled  chan struct{}
+	block   chan struct{}
+	mu      sync.Mutex
+	deleted []string
+}
+
+func (t *blockingJobQuerier) CreateJob(string, humio.Query) (string, error) {
+	return "job", nil
+}
+
+func (t *blockingJobQuerier) PollJob(string, string) (humio.QueryResult, error) {
+	select {
+	case t.polled <- struct{}{}:
+	default:
+	}
+	if t.block != nil {
+		<-t.block
+	}
+	return humio.QueryResult{Metadata: humio.QueryResultMetadata{PollAfter: 10}}, nil
+}
+
+func (t *blockingJobQuerier) DeleteJob(_ string, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deleted = append(t.deleted, id)
+	return nil
+}
+
+func (t *blockingJobQuerier) Deleted() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleted
+}
+
+type liveJobPoll struct {
+	result humio.QueryResult
+	err    error
+}
+
+// liveJobQuerier answers polls of live jobs in order and then repeats the
+// last answer.
+type liveJobQuerier struct {
+	TestJobQuerier
+	mu        sync.Mutex
+	polls     []liveJobPoll
+	createErr error
+	created   []humio.Query
+	deleted   []string
+}
+
+func (t *liveJobQuerier) CreateJob(repo string, query humio.Query) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.createErr != nil {
+		return "", t.createErr
+	}
+	t.created = append(t.created, query)
+	return fmt.Sprintf("job-%d", len(t.created)), nil
+}
+
+func (t *liveJobQuerier) DeleteJob(repo string, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deleted = append(t.deleted, id)
+	return nil
+}
+
+func (t *liveJobQuerier) PollJob(repo string, id string) (humio.QueryResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.polls[0]
+	if len(t.polls) > 1 {
+		t.polls = t.polls[1:]
+	}
+	return p.result, p.err
+}
+
+// reconnectingJobQuerier sends one batch of events per call to Stream and then
+// drops the connection, or returns err when set. After the last batch the
+// stream stays open until the context is done.
+type reconnectingJobQuerier struct {
+	TestJobQuerier
+	batches [][]humio.StreamingResults
+	err     error
+	starts  []string
+	paths   []string
+}
+
+func (t *reconnectingJobQuerier) Stream(ctx context.Context, _ string, path string, query humio.Query, ch chan humio.StreamingResults) error {
+	t.paths = append(t.paths, path)
+	if t.err != nil {
+		return t.err
+	}
+	call := len(t.starts)
+	t.starts = append(t.starts, query.Start)
+	if call >= len(t.batches) {
+		<-ctx.Done()
+		return nil
+	}
+	for _, e := range t.batches[call] {
+		ch <- e
+	}
+	if call == len(t.batches)-1 {
+		<-ctx.Done()
+		return nil
+	}
+	return errors.New("connection reset")
 }
 
 type TestJobQuerier struct {
 	id          string
 	queryResult humio.QueryResult
 	repos       []string
+	searches    []humio.SavedSearch
+	metadata    []humio.RepositoryMetadata
+	domains     []humio.SearchDomain
+	createErrs  map[string]error
 }
 
 // Stream implements humio.JobQuerier.
@@ -51,6 +383,9 @@ func (t TestJobQuerier) Stream(ctx context.Context, method string, path string,
 }
 
 func (t TestJobQuerier) CreateJob(repo string, query humio.Query) (string, error) {
+	if err, ok := t.createErrs[repo]; ok {
+		return "", err
+	}
 	return t.id, nil
 }
 
@@ -66,6 +401,18 @@ func (t TestJobQuerier) ListRepos() ([]string, error) {
 	return t.repos, nil
 }
 
+func (t TestJobQuerier) ListSavedSearches(repo string) ([]humio.SavedSearch, error) {
+	return t.searches, nil
+}
+
+func (t TestJobQuerier) ListSearchDomains() ([]humio.SearchDomain, error) {
+	return t.domains, nil
+}
+
+func (t TestJobQuerier) ListRepoMetadata() ([]humio.RepositoryMetadata, error) {
+	return t.metadata, nil
+}
+
 func (t TestJobQuerier) SetAuthHeaders(authHeaders map[string]string) error { return nil }
 
 func (t TestJobQuerier) OauthClientSecretHealthCheck() error { return nil }
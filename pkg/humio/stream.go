@@ -0,0 +1,278 @@
+package humio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamStalled is returned by Stream when nothing was received within the
+// stall timeout.
+var ErrStreamStalled = errors.New("stream stalled")
+
+const (
+	streamInitialBackoff = time.Second
+	streamMaxBackoff     = 30 * time.Second
+	// streamSeenIDs is the number of recent event IDs kept to drop events that
+	// are sent again after resuming a stream.
+	streamSeenIDs = 10000
+)
+
+type StreamState string
+
+const (
+	StreamStateConnected    StreamState = "connected"
+	StreamStateReconnecting StreamState = "reconnecting"
+	StreamStateFailed       StreamState = "failed"
+)
+
+// StreamStatus reports a change in the connection of a live stream. Attempt
+// counts the reconnects since the stream last received data and Err is the
+// reason for reconnecting or failing.
+type StreamStatus struct {
+	State   StreamState
+	Attempt int
+	Err     error
+}
+
+// stallWatchdog cancels a stream when its reader has not returned data within
+// the timeout. Time spent in Blocked, waiting for the consumer, does not count,
+// as a slow consumer stops reads just as a quiet upstream does.
+type stallWatchdog struct {
+	timeout  time.Duration
+	last     atomic.Int64
+	paused   atomic.Bool
+	stalled  atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newStallWatchdog(timeout time.Duration, cancel context.CancelFunc) *stallWatchdog {
+	w := &stallWatchdog{timeout: timeout, stop: make(chan struct{})}
+	w.touch()
+	if timeout <= 0 {
+		return w
+	}
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if w.paused.Load() {
+					continue
+				}
+				if time.Since(time.Unix(0, w.last.Load())) >= timeout {
+					w.stalled.Store(true)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *stallWatchdog) touch() {
+	w.last.Store(time.Now().UnixNano())
+}
+
+// Reader returns r with every read that returns data counting as activity, so
+// heartbeat newlines keep a quiet stream alive.
+func (w *stallWatchdog) Reader(r io.Reader) io.Reader {
+	return &activityReader{r: r, w: w}
+}
+
+// Blocked runs send, which hands data to the consumer, with the watchdog
+// paused. The timeout starts over once send returns.
+func (w *stallWatchdog) Blocked(send func()) {
+	w.paused.Store(true)
+	defer func() {
+		w.touch()
+		w.paused.Store(false)
+	}()
+	send()
+}
+
+func (w *stallWatchdog) Stalled() bool {
+	return w.stalled.Load()
+}
+
+func (w *stallWatchdog) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+type activityReader struct {
+	r io.Reader
+	w *stallWatchdog
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.w.touch()
+	}
+	return n, err
+}
+
+// streamResume remembers where a stream got to, so a reconnected stream starts
+// at the last seen @timestamp and events sent again are dropped by @id.
+type streamResume struct {
+	lastTimestamp int64
+	resumed       bool
+	seen          map[string]struct{}
+	order         []string
+}
+
+func newStreamResume() *streamResume {
+	return &streamResume{seen: map[string]struct{}{}}
+}
+
+// Start returns the start to send when reconnecting, or the start of the query
+// before the first event was seen.
+func (r *streamResume) Start(query Query) string {
+	if r.lastTimestamp == 0 {
+		return query.Start
+	}
+	return strconv.FormatInt(r.lastTimestamp, 10)
+}
+
+// Accept records the event and reports whether it is new. After a reconnect,
+// events without an @id are only accepted when they are newer than the last
+// seen event.
+func (r *streamResume) Accept(event StreamingResults) bool {
+	ts, hasTimestamp := eventTimestamp(event)
+	id, hasID := event["@id"].(string)
+	if hasID {
+		if _, ok := r.seen[id]; ok {
+			return false
+		}
+		r.remember(id)
+	} else if r.resumed && hasTimestamp && ts <= r.lastTimestamp {
+		return false
+	}
+	if hasTimestamp && ts > r.lastTimestamp {
+		r.lastTimestamp = ts
+	}
+	return true
+}
+
+func (r *streamResume) remember(id string) {
+	r.seen[id] = struct{}{}
+	r.order = append(r.order, id)
+	if len(r.order) > streamSeenIDs {
+		delete(r.seen, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func eventTimestamp(event StreamingResults) (int64, bool) {
+	switch v := event["@timestamp"].(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		ts, err := strconv.ParseInt(v, 10, 64)
+		return ts, err == nil
+	}
+	return 0, false
+}
+
+// permanentStreamError reports whether reconnecting cannot fix the error.
+func permanentStreamError(err error) bool {
+	return errors.Is(err, ErrUnauthorized) ||
+		errors.Is(err, ErrForbidden) ||
+		errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrBadRequest)
+}
+
+// streamWithReconnect streams the query into c until ctx is done, reconnecting
+// with backoff when the stream drops or stalls and resuming after the last
+// event seen. Changes in the connection are sent to status when it is not nil.
+func (qr *QueryRunner) streamWithReconnect(ctx context.Context, endPoint string, method string, query Query, c chan StreamingResults, status chan<- StreamStatus) error {
+	resume := newStreamResume()
+	backoff := streamInitialBackoff
+	attempt := 0
+	report := func(s StreamStatus) {
+		if status == nil {
+			return
+		}
+		select {
+		case status <- s:
+		case <-ctx.Done():
+		}
+	}
+
+	for {
+		events := make(chan StreamingResults)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			first := true
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e, ok := <-events:
+					if !ok {
+						return
+					}
+					if first {
+						// data is flowing again, so start over with the backoff
+						first = false
+						if attempt > 0 {
+							report(StreamStatus{State: StreamStateConnected, Attempt: attempt})
+						}
+						attempt = 0
+						backoff = streamInitialBackoff
+					}
+					if !resume.Accept(e) {
+						continue
+					}
+					select {
+					case c <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+
+		q := query
+		q.Start = resume.Start(query)
+		err := qr.JobQuerier.Stream(ctx, method, endPoint, q, events)
+		close(events)
+		<-done
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		if permanentStreamError(err) {
+			report(StreamStatus{State: StreamStateFailed, Attempt: attempt, Err: err})
+			return err
+		}
+
+		attempt++
+		resume.resumed = resume.lastTimestamp != 0
+		report(StreamStatus{State: StreamStateReconnecting, Attempt: attempt, Err: fmt.Errorf("live tail disconnected: %w", err)})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 )
 
 type RepoVariableResponse struct {
-	Name  string
-	Value string
+	Name        string
+	Value       string
+	Type        string
+	Connections string
 }
 
 func ConvertRepos(repos []string) []RepoVariableResponse {
@@ -26,6 +28,45 @@ func ConvertRepos(repos []string) []RepoVariableResponse {
 	return reposMapped
 }
 
+// ConvertSearchDomains maps search domains to variable values. The connections
+// of a view are rendered as "repository: filter" pairs.
+func ConvertSearchDomains(domains []SearchDomain) []RepoVariableResponse {
+	reposMapped := []RepoVariableResponse{}
+	for _, d := range domains {
+		var connections []string
+		for _, c := range d.Connections {
+			if c.Filter == "" {
+				connections = append(connections, c.Repository)
+				continue
+			}
+			connections = append(connections, c.Repository+": "+c.Filter)
+		}
+		reposMapped = append(reposMapped, RepoVariableResponse{
+			Name:        d.Name,
+			Value:       d.Name,
+			Type:        d.Type,
+			Connections: strings.Join(connections, "; "),
+		})
+	}
+
+	return reposMapped
+}
+
+// FilterSearchDomains returns the search domains of the given type. An empty
+// type returns all of them.
+func FilterSearchDomains(domains []SearchDomain, domainType string) []SearchDomain {
+	if domainType == "" {
+		return domains
+	}
+	filtered := []SearchDomain{}
+	for _, d := range domains {
+		if d.Type == domainType {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
+
 // Returns true if the token can be parsed and is expired, false otherwise
 func IsExpired(token string) bool {
 	if token != "" {
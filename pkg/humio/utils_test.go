@@ -98,3 +98,28 @@ func TestIsExpired(t *testing.T) {
 		require.False(t, result)
 	})
 }
+
+func TestConvertSearchDomains(t *testing.T) {
+	domains := []humio.SearchDomain{
+		{Name: "repo1", Type: humio.SearchDomainTypeRepository},
+		{Name: "view1", Type: humio.SearchDomainTypeView, Connections: []humio.ViewConnection{
+			{Repository: "repo1", Filter: "#type=accesslog"},
+			{Repository: "repo2"},
+		}},
+	}
+
+	t.Run("renders view connections", func(t *testing.T) {
+		r := humio.ConvertSearchDomains(domains)
+		require.Len(t, r, 2)
+		require.Equal(t, "", r[0].Connections)
+		require.Equal(t, humio.SearchDomainTypeView, r[1].Type)
+		require.Equal(t, "repo1: #type=accesslog; repo2", r[1].Connections)
+	})
+
+	t.Run("filters by type", func(t *testing.T) {
+		require.Len(t, humio.FilterSearchDomains(domains, ""), 2)
+		views := humio.FilterSearchDomains(domains, humio.SearchDomainTypeView)
+		require.Len(t, views, 1)
+		require.Equal(t, "view1", views[0].Name)
+	})
+}
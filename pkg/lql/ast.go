@@ -0,0 +1,323 @@
+package lql
+
+import (
+	"strings"
+)
+
+// Node is an element of a parsed query. String returns its exact source text.
+type Node interface {
+	String() string
+}
+
+// Pipeline is a sequence of stages separated by pipes.
+type Pipeline struct {
+	Stages []*Stage
+}
+
+func (p *Pipeline) String() string {
+	stages := make([]string, len(p.Stages))
+	for i, s := range p.Stages {
+		stages[i] = s.String()
+	}
+	return strings.Join(stages, "|")
+}
+
+// Stage is one step of a pipeline, including the whitespace and comments
+// around it.
+type Stage struct {
+	Nodes []Node
+}
+
+func (s *Stage) String() string {
+	return nodesString(s.Nodes)
+}
+
+// Function returns the function call when the stage consists of a single call,
+// or nil otherwise.
+func (s *Stage) Function() *FunctionCall {
+	var fn *FunctionCall
+	for _, n := range s.Nodes {
+		switch n := n.(type) {
+		case *Space, *Comment:
+			continue
+		case *FunctionCall:
+			if fn != nil {
+				return nil
+			}
+			fn = n
+		default:
+			return nil
+		}
+	}
+	return fn
+}
+
+// IsFilter reports whether the stage filters events rather than calling a
+// function or assigning a field.
+func (s *Stage) IsFilter() bool {
+	if s.Function() != nil || len(Significant(s.Nodes)) == 0 {
+		return false
+	}
+	for _, n := range s.Nodes {
+		if op, ok := n.(*Operator); ok && op.Text == ":=" {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldFilters returns the field comparisons at the top level of the stage,
+// such as status=200 or #type!=/access/.
+func (s *Stage) FieldFilters() []FieldFilter {
+	nodes := Significant(s.Nodes)
+	var filters []FieldFilter
+	for i := 0; i+2 < len(nodes); i++ {
+		field, ok := nodes[i].(*Word)
+		if !ok || IsKeyword(field.Text) {
+			continue
+		}
+		op, ok := nodes[i+1].(*Operator)
+		if !ok || !isComparison(op.Text) {
+			continue
+		}
+		filters = append(filters, FieldFilter{Field: field.Text, Op: op.Text, Value: nodes[i+2]})
+		i += 2
+	}
+	return filters
+}
+
+// FieldFilter is a comparison of a field with a value.
+type FieldFilter struct {
+	Field string
+	Op    string
+	Value Node
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "=", "!=", "<", ">", "<=", ">=", "==", "=~", "<=>":
+		return true
+	}
+	return false
+}
+
+// FunctionCall is a call such as groupBy(field, function=count()).
+type FunctionCall struct {
+	Name string
+	Args []*Argument
+}
+
+func (f *FunctionCall) String() string {
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = a.String()
+	}
+	return f.Name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Arg returns the named argument, or nil if the call does not set it. Names are
+// compared case-insensitively, as LogScale does.
+func (f *FunctionCall) Arg(name string) *Argument {
+	for _, a := range f.Args {
+		if strings.EqualFold(a.Name, name) {
+			return a
+		}
+	}
+	return nil
+}
+
+// SetArg sets the named argument to value, appending it if the call does not
+// have it yet. The value is parsed as LQL.
+func (f *FunctionCall) SetArg(name string, value string) error {
+	nodes, err := parseFragment(value)
+	if err != nil {
+		return err
+	}
+	if a := f.Arg(name); a != nil {
+		a.Value = nodes
+		return nil
+	}
+	if len(f.Args) == 1 && len(Significant(f.Args[0].Value)) == 0 && f.Args[0].Name == "" {
+		// a call without arguments, such as count(), has a single empty argument
+		f.Args = nil
+	}
+	arg := &Argument{Name: name, Assign: "=", Value: nodes}
+	if len(f.Args) > 0 {
+		// keep whitespace before the closing parenthesis after the new argument
+		last := f.Args[len(f.Args)-1]
+		value, trailing := splitTrailingSpace(last.Value)
+		last.Value = value
+		arg.Prefix = []Node{&Space{Text: " "}}
+		arg.Value = append(arg.Value, trailing...)
+	}
+	f.Args = append(f.Args, arg)
+	return nil
+}
+
+// Argument is a function argument. Name is empty for the unnamed argument.
+// Prefix holds whitespace and comments before the argument and Assign the
+// text between the name and the value, such as "=" or " = ".
+type Argument struct {
+	Prefix []Node
+	Name   string
+	Assign string
+	Value  []Node
+}
+
+func (a *Argument) String() string {
+	return nodesString(a.Prefix) + a.Name + a.Assign + nodesString(a.Value)
+}
+
+// Subquery is a pipeline in braces, as used by case, match and function
+// arguments such as function={ ... }.
+type Subquery struct {
+	Pipeline *Pipeline
+}
+
+func (s *Subquery) String() string {
+	return "{" + s.Pipeline.String() + "}"
+}
+
+// Group is a parenthesized expression or a bracketed list. Items holds the
+// comma separated elements.
+type Group struct {
+	Open  string
+	Close string
+	Items [][]Node
+}
+
+func (g *Group) String() string {
+	items := make([]string, len(g.Items))
+	for i, item := range g.Items {
+		items[i] = nodesString(item)
+	}
+	return g.Open + strings.Join(items, ",") + g.Close
+}
+
+type Space struct{ Text string }
+
+type Comment struct{ Text string }
+
+// String is a quoted string literal including its quotes.
+type String struct{ Text string }
+
+// Regex is a regex literal including its slashes and flags.
+type Regex struct{ Text string }
+
+// Word is a field name, free text search term or other bare word.
+type Word struct{ Text string }
+
+type Number struct{ Text string }
+
+type Operator struct{ Text string }
+
+func (n *Space) String() string    { return n.Text }
+func (n *Comment) String() string  { return n.Text }
+func (n *String) String() string   { return n.Text }
+func (n *Regex) String() string    { return n.Text }
+func (n *Word) String() string     { return n.Text }
+func (n *Number) String() string   { return n.Text }
+func (n *Operator) String() string { return n.Text }
+
+// Value returns the string literal without quotes and escapes.
+func (n *String) Value() string {
+	s := strings.TrimSuffix(strings.TrimPrefix(n.Text, `"`), `"`)
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+// Significant returns the nodes that are neither whitespace nor comments.
+func Significant(nodes []Node) []Node {
+	var significant []Node
+	for _, n := range nodes {
+		if !isTrivia(n) {
+			significant = append(significant, n)
+		}
+	}
+	return significant
+}
+
+// Walk calls fn for every node below the pipeline, depth first. Returning false
+// from fn skips the children of the node.
+func Walk(p *Pipeline, fn func(Node) bool) {
+	for _, s := range p.Stages {
+		walkNodes(s.Nodes, fn)
+	}
+}
+
+func walkNodes(nodes []Node, fn func(Node) bool) {
+	for _, n := range nodes {
+		if !fn(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *FunctionCall:
+			for _, a := range n.Args {
+				walkNodes(a.Value, fn)
+			}
+		case *Group:
+			for _, item := range n.Items {
+				walkNodes(item, fn)
+			}
+		case *Subquery:
+			Walk(n.Pipeline, fn)
+		}
+	}
+}
+
+// Functions returns every function call in the pipeline, including calls nested
+// in arguments and subqueries.
+func (p *Pipeline) Functions() []*FunctionCall {
+	var calls []*FunctionCall
+	Walk(p, func(n Node) bool {
+		if fn, ok := n.(*FunctionCall); ok {
+			calls = append(calls, fn)
+		}
+		return true
+	})
+	return calls
+}
+
+// Prepend inserts a stage, such as a filter, at the start of the pipeline.
+func (p *Pipeline) Prepend(stage string) error {
+	nodes, err := parseFragment(stage)
+	if err != nil {
+		return err
+	}
+	if len(p.Stages) == 0 || (len(p.Stages) == 1 && len(Significant(p.Stages[0].Nodes)) == 0) {
+		p.Stages = []*Stage{{Nodes: nodes}}
+		return nil
+	}
+	s := &Stage{Nodes: append(nodes, &Space{Text: " "})}
+	if !startsWithSpace(p.Stages[0].Nodes) {
+		p.Stages[0].Nodes = append([]Node{&Space{Text: " "}}, p.Stages[0].Nodes...)
+	}
+	p.Stages = append([]*Stage{s}, p.Stages...)
+	return nil
+}
+
+func nodesString(nodes []Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(n.String())
+	}
+	return b.String()
+}
+
+func startsWithSpace(nodes []Node) bool {
+	if len(nodes) == 0 {
+		return false
+	}
+	_, ok := nodes[0].(*Space)
+	return ok
+}
+
+func splitTrailingSpace(nodes []Node) ([]Node, []Node) {
+	i := len(nodes)
+	for i > 0 {
+		if _, ok := nodes[i-1].(*Space); !ok {
+			break
+		}
+		i--
+	}
+	return nodes[:i], nodes[i:]
+}
@@ -0,0 +1,201 @@
+package lql
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// maxLineWidth is the width up to which calls, lists and subqueries are kept
+// on a single line.
+const maxLineWidth = 80
+
+const indentUnit = "  "
+
+// Format pretty-prints a query. Each pipe stage goes on its own line, runs of
+// whitespace are collapsed and calls, lists and subqueries that do not fit on
+// a line are broken up with their contents indented. Comments, strings and
+// regexes are kept as they are.
+func Format(src string) (string, error) {
+	p, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	formatted := strings.TrimRight(formatPipeline(p, 0), " \n")
+	if !sameTokens(src, formatted) {
+		return "", ErrAmbiguous
+	}
+	return formatted, nil
+}
+
+// ErrAmbiguous is returned when the formatted query would not read back as the
+// same tokens, so formatting could change what the query means.
+var ErrAmbiguous = errors.New("the query cannot be formatted without changing its meaning")
+
+// sameTokens reports whether both queries have the same tokens apart from
+// whitespace and commas, which are the only tokens formatting adds or drops.
+func sameTokens(src, formatted string) bool {
+	significant := func(q string) ([]Token, bool) {
+		tokens, err := Tokenize(q)
+		if err != nil {
+			return nil, false
+		}
+		var out []Token
+		for _, t := range tokens {
+			if t.Kind != TokenSpace && t.Kind != TokenComma {
+				out = append(out, Token{Kind: t.Kind, Text: t.Text})
+			}
+		}
+		return out, true
+	}
+	a, ok := significant(src)
+	if !ok {
+		return false
+	}
+	b, ok := significant(formatted)
+	return ok && slices.Equal(a, b)
+}
+
+func formatPipeline(p *Pipeline, indent int) string {
+	var b strings.Builder
+	for i, s := range p.Stages {
+		stage := formatNodes(s.Nodes, indent)
+		if i > 0 {
+			if !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n")
+			}
+			b.WriteString(indentation(indent) + "| ")
+		}
+		b.WriteString(stage)
+	}
+	return b.String()
+}
+
+func formatNodes(nodes []Node, indent int) string {
+	var b strings.Builder
+	space := false
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Space:
+			space = b.Len() > 0 && !strings.HasSuffix(b.String(), "\n"+indentation(indent))
+			continue
+		case *Comment:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n"+indentation(indent)) {
+				b.WriteByte(' ')
+			}
+			b.WriteString(n.Text)
+			space = false
+			if strings.HasPrefix(n.Text, "//") {
+				b.WriteString("\n" + indentation(indent))
+			}
+			continue
+		case *Operator:
+			if n.Text == ";" {
+				b.WriteString(";\n" + indentation(indent))
+				space = false
+				continue
+			}
+		}
+		if space {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(formatNode(n, indent))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func formatNode(n Node, indent int) string {
+	switch n := n.(type) {
+	case *FunctionCall:
+		return formatCall(n, indent)
+	case *Group:
+		if n.Open == "(" {
+			items := make([]string, len(n.Items))
+			for i, item := range n.Items {
+				items[i] = formatNodes(item, indent)
+			}
+			return "(" + strings.Join(items, ", ") + ")"
+		}
+		return formatList(n.Open, n.Close, func(indent int) []string {
+			items := make([]string, 0, len(n.Items))
+			for _, item := range n.Items {
+				if s := formatNodes(item, indent); s != "" {
+					items = append(items, s)
+				}
+			}
+			return items
+		}, indent)
+	case *Subquery:
+		return formatSubquery(n, indent)
+	}
+	return n.String()
+}
+
+func formatCall(fn *FunctionCall, indent int) string {
+	return formatList(fn.Name+"(", ")", func(indent int) []string {
+		args := make([]string, 0, len(fn.Args))
+		for _, a := range fn.Args {
+			value := formatNodes(a.Value, indent)
+			if a.Name != "" {
+				// comments before a named argument are kept in its prefix
+				prefix := formatNodes(a.Prefix, indent)
+				switch {
+				case strings.HasSuffix(prefix, "\n"):
+					prefix += indentation(indent)
+				case prefix != "":
+					prefix += " "
+				}
+				args = append(args, prefix+a.Name+"="+value)
+				continue
+			}
+			if value != "" {
+				args = append(args, value)
+			}
+		}
+		return args
+	}, indent)
+}
+
+// formatList prints comma separated items on one line if they fit, or one per
+// line indented otherwise. items formats the items at the given indentation.
+func formatList(open string, close string, items func(indent int) []string, indent int) string {
+	inline := open + strings.Join(items(indent), ", ") + close
+	if !strings.Contains(inline, "\n") && len(indentation(indent))+len(inline) <= maxLineWidth {
+		return inline
+	}
+
+	var b strings.Builder
+	b.WriteString(open + "\n")
+	for i, item := range items(indent + 1) {
+		if i > 0 {
+			if !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString(",\n")
+			} else {
+				b.WriteString(indentation(indent+1) + ",\n")
+			}
+		}
+		b.WriteString(indentation(indent+1) + item)
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(indentation(indent) + close)
+	return b.String()
+}
+
+func formatSubquery(s *Subquery, indent int) string {
+	inline := formatPipeline(s.Pipeline, indent)
+	if inline == "" {
+		return "{}"
+	}
+	if len(s.Pipeline.Stages) == 1 && !strings.Contains(inline, "\n") && len(indentation(indent))+len(inline)+4 <= maxLineWidth {
+		return "{ " + inline + " }"
+	}
+	inner := strings.TrimRight(formatPipeline(s.Pipeline, indent+1), " \n")
+	return "{\n" + indentation(indent+1) + inner + "\n" + indentation(indent) + "}"
+}
+
+func indentation(indent int) string {
+	return strings.Repeat(indentUnit, indent)
+}
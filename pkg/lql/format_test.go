@@ -0,0 +1,111 @@
+package lql_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "puts each stage on its own line",
+			query:    `#type=accesslog   status>=500|groupBy(host)|sort(_count,   limit=10)`,
+			expected: "#type=accesslog status>=500\n| groupBy(host)\n| sort(_count, limit=10)",
+		},
+		{
+			name:  "indents long function arguments",
+			query: `groupBy(host, function=[count(), avg(responsetime), max(responsetime), percentile(responsetime, percentiles=[50,99])])`,
+			expected: `groupBy(
+  host,
+  function=[
+    count(),
+    avg(responsetime),
+    max(responsetime),
+    percentile(responsetime, percentiles=[50, 99])
+  ]
+)`,
+		},
+		{
+			name:  "breaks case blocks into branches",
+			query: `case { status>=500 | level:="error" ; * }`,
+			expected: `case {
+  status>=500
+  | level:="error";
+  *
+}`,
+		},
+		{
+			name:     "keeps short subqueries inline",
+			query:    `join({#type=users},field=id)`,
+			expected: `join({ #type=users }, field=id)`,
+		},
+		{
+			name:     "keeps comments and literals",
+			query:    "// errors\nlevel=ERROR  // only\n|  msg=\"a  |  b\" url=/x  y/",
+			expected: "// errors\nlevel=ERROR // only\n| msg=\"a  |  b\" url=/x  y/",
+		},
+		{
+			name:     "keeps comments in function arguments",
+			query:    `groupBy(/* keep */ field=a, /* also */ b)`,
+			expected: `groupBy(/* keep */ field=a, /* also */ b)`,
+		},
+		{
+			name:  "keeps line comments before named arguments",
+			query: "groupBy(host, // by status\nfield=status)",
+			expected: `groupBy(
+  host,
+  // by status
+  field=status
+)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted, err := lql.Format(tt.query)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, formatted)
+
+			again, err := lql.Format(formatted)
+			require.NoError(t, err)
+			require.Equal(t, formatted, again)
+		})
+	}
+
+	t.Run("never changes strings, regexes or comments", func(t *testing.T) {
+		literals := func(q string) []string {
+			tokens, err := lql.Tokenize(q)
+			require.NoError(t, err, q)
+			var out []string
+			for _, tok := range tokens {
+				switch tok.Kind {
+				case lql.TokenString, lql.TokenRegex, lql.TokenComment:
+					out = append(out, tok.Text)
+				}
+			}
+			return out
+		}
+		for _, query := range []string{
+			`error /time  out/`,
+			`x /a|b/`,
+			`error /a(b/`,
+			`status=500 /timeout/i | count()`,
+			`msg="a  |  b" /* keep  this */ | groupBy(host, function=count()) // and  this`,
+			`x := a / 2 | y := "c  d" | regex("(?<e>\d+)", field=x)`,
+		} {
+			formatted, err := lql.Format(query)
+			require.NoError(t, err, query)
+			require.Equal(t, literals(query), literals(formatted), query)
+		}
+	})
+
+	t.Run("returns syntax errors", func(t *testing.T) {
+		_, err := lql.Format(`groupBy(host`)
+		require.Error(t, err)
+	})
+}
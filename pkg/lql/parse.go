@@ -0,0 +1,242 @@
+package lql
+
+// Parse parses a query into a pipeline. Printing the pipeline with String
+// gives back the query unchanged.
+func Parse(src string) (*Pipeline, error) {
+	tokens, err := Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	pipeline, err := p.parsePipeline(TokenEOF)
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.unexpected()
+	}
+	return pipeline, nil
+}
+
+// parseFragment parses a piece of a query, such as an argument value, into
+// nodes.
+func parseFragment(src string) ([]Node, error) {
+	tokens, err := Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	nodes, err := p.parseNodes(TokenEOF)
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.unexpected()
+	}
+	return nodes, nil
+}
+
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() TokenKind {
+	if p.done() {
+		return TokenEOF
+	}
+	return p.tokens[p.pos].Kind
+}
+
+func (p *parser) next() Token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *parser) unexpected() error {
+	if p.done() {
+		return &SyntaxError{Pos: p.endPos(), Msg: "unexpected end of query"}
+	}
+	t := p.tokens[p.pos]
+	return &SyntaxError{Pos: t.Pos, Msg: "unexpected " + t.Text}
+}
+
+func (p *parser) endPos() int {
+	if len(p.tokens) == 0 {
+		return 0
+	}
+	last := p.tokens[len(p.tokens)-1]
+	return last.Pos + len(last.Text)
+}
+
+// parsePipeline parses stages separated by pipes up to, but not including, the
+// closing token.
+func (p *parser) parsePipeline(closing TokenKind) (*Pipeline, error) {
+	pipeline := &Pipeline{}
+	for {
+		nodes, err := p.parseNodes(TokenPipe, closing)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Stages = append(pipeline.Stages, &Stage{Nodes: nodes})
+		if p.peek() != TokenPipe {
+			return pipeline, nil
+		}
+		p.next()
+	}
+}
+
+// parseNodes parses nodes until one of the stop tokens, which is not consumed,
+// or the end of the query.
+func (p *parser) parseNodes(stops ...TokenKind) ([]Node, error) {
+	var nodes []Node
+	for !p.done() {
+		kind := p.peek()
+		for _, stop := range stops {
+			if kind == stop {
+				return nodes, nil
+			}
+		}
+		n, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseNode() (Node, error) {
+	t := p.next()
+	switch t.Kind {
+	case TokenSpace:
+		return &Space{Text: t.Text}, nil
+	case TokenComment:
+		return &Comment{Text: t.Text}, nil
+	case TokenString:
+		return &String{Text: t.Text}, nil
+	case TokenRegex:
+		return &Regex{Text: t.Text}, nil
+	case TokenNumber:
+		return &Number{Text: t.Text}, nil
+	case TokenOperator, TokenPipe, TokenComma:
+		return &Operator{Text: t.Text}, nil
+	case TokenWord:
+		if p.peek() == TokenLParen {
+			p.next()
+			return p.parseCall(t.Text)
+		}
+		return &Word{Text: t.Text}, nil
+	case TokenLParen:
+		return p.parseGroup(t, TokenRParen)
+	case TokenLBracket:
+		return p.parseGroup(t, TokenRBracket)
+	case TokenLBrace:
+		pipeline, err := p.parsePipeline(TokenRBrace)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != TokenRBrace {
+			return nil, &SyntaxError{Pos: t.Pos, Msg: "unclosed {"}
+		}
+		p.next()
+		return &Subquery{Pipeline: pipeline}, nil
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseCall(name string) (Node, error) {
+	call := &FunctionCall{Name: name}
+	for {
+		nodes, err := p.parseNodes(TokenComma, TokenRParen)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, newArgument(nodes))
+		switch p.peek() {
+		case TokenComma:
+			p.next()
+		case TokenRParen:
+			p.next()
+			return call, nil
+		default:
+			return nil, &SyntaxError{Pos: p.endPos(), Msg: "unclosed call to " + name}
+		}
+	}
+}
+
+func (p *parser) parseGroup(open Token, closing TokenKind) (Node, error) {
+	group := &Group{Open: open.Text}
+	for {
+		nodes, err := p.parseNodes(TokenComma, closing)
+		if err != nil {
+			return nil, err
+		}
+		group.Items = append(group.Items, nodes)
+		switch p.peek() {
+		case TokenComma:
+			p.next()
+		case closing:
+			group.Close = p.next().Text
+			return group, nil
+		default:
+			return nil, &SyntaxError{Pos: open.Pos, Msg: "unclosed " + open.Text}
+		}
+	}
+}
+
+// newArgument splits the nodes of an argument into its name and value when it
+// has the form name=value.
+func newArgument(nodes []Node) *Argument {
+	i := 0
+	for i < len(nodes) && isTrivia(nodes[i]) {
+		i++
+	}
+	if i >= len(nodes) {
+		return &Argument{Value: nodes}
+	}
+	name, ok := nodes[i].(*Word)
+	if !ok {
+		return &Argument{Value: nodes}
+	}
+	j := i + 1
+	assign := ""
+	for j < len(nodes) {
+		if s, ok := nodes[j].(*Space); ok {
+			assign += s.Text
+			j++
+			continue
+		}
+		break
+	}
+	if op, ok := nodeAt(nodes, j).(*Operator); !ok || op.Text != "=" {
+		return &Argument{Value: nodes}
+	}
+	return &Argument{
+		Prefix: nodes[:i],
+		Name:   name.Text,
+		Assign: assign + "=",
+		Value:  nodes[j+1:],
+	}
+}
+
+func nodeAt(nodes []Node, i int) Node {
+	if i < len(nodes) {
+		return nodes[i]
+	}
+	return nil
+}
+
+func isTrivia(n Node) bool {
+	switch n.(type) {
+	case *Space, *Comment:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package lql_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	queries := []string{
+		``,
+		`count()`,
+		`#type=accesslog | groupBy(host, function=[count(), avg(responsetime)])`,
+		"// comment\n  error  and not /timeout/i\n| timeChart( span = 1m ) ",
+		`case { status>=500 | level:="error" ; status>=400 | level:="warn" ; * }`,
+		`x := (a + b) / 2 | format("%s-%s", field=[a, b], as=id)`,
+		`$savedSearch(param="value") | array:contains("tags[]", value="x")`,
+		`join({#type=users}, field=userid, include=[name])`,
+	}
+	for _, q := range queries {
+		p, err := lql.Parse(q)
+		require.NoError(t, err, q)
+		require.Equal(t, q, p.String())
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("parses stages", func(t *testing.T) {
+		p, err := lql.Parse(`status=200 method!="GET" | groupBy(host, function=count()) | x := 1`)
+		require.NoError(t, err)
+		require.Len(t, p.Stages, 3)
+
+		require.True(t, p.Stages[0].IsFilter())
+		filters := p.Stages[0].FieldFilters()
+		require.Len(t, filters, 2)
+		require.Equal(t, "method", filters[1].Field)
+		require.Equal(t, "!=", filters[1].Op)
+		require.Equal(t, "GET", filters[1].Value.(*lql.String).Value())
+
+		fn := p.Stages[1].Function()
+		require.NotNil(t, fn)
+		require.Equal(t, "groupBy", fn.Name)
+		require.Equal(t, "", fn.Args[0].Name)
+		require.Equal(t, "count()", fn.Arg("function").Value[0].String())
+
+		require.False(t, p.Stages[2].IsFilter())
+		require.Nil(t, p.Stages[2].Function())
+	})
+
+	t.Run("finds nested functions", func(t *testing.T) {
+		p, err := lql.Parse(`case { a=1 | bucket(function=count()) ; * } | groupBy(x, function={ sort(y) })`)
+		require.NoError(t, err)
+		var names []string
+		for _, fn := range p.Functions() {
+			names = append(names, fn.Name)
+		}
+		require.Equal(t, []string{"bucket", "count", "groupBy", "sort"}, names)
+	})
+
+	t.Run("reports unbalanced brackets", func(t *testing.T) {
+		for _, q := range []string{`count(`, `groupBy(x))`, `case { a`, `[a, b`} {
+			_, err := lql.Parse(q)
+			require.Error(t, err, q)
+		}
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	t.Run("sets arguments", func(t *testing.T) {
+		p, err := lql.Parse(`timeChart() | bucket(x ) | bucket(span=1h)`)
+		require.NoError(t, err)
+		for _, fn := range p.Functions() {
+			require.NoError(t, fn.SetArg("span", "5m"))
+		}
+		require.Equal(t, `timeChart(span=5m) | bucket(x, span=5m ) | bucket(span=5m)`, p.String())
+	})
+
+	t.Run("prepends a filter", func(t *testing.T) {
+		p, err := lql.Parse(`count()`)
+		require.NoError(t, err)
+		require.NoError(t, p.Prepend(`host="web-1"`))
+		require.Equal(t, `host="web-1" | count()`, p.String())
+
+		p, err = lql.Parse(``)
+		require.NoError(t, err)
+		require.NoError(t, p.Prepend(`host="web-1"`))
+		require.Equal(t, `host="web-1"`, p.String())
+	})
+}
@@ -0,0 +1,290 @@
+// Package lql tokenizes and parses LogScale Query Language into a lossless
+// pipeline AST that prints back to the exact source text.
+package lql
+
+import (
+	"fmt"
+	"strings"
+)
+
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenSpace
+	TokenComment
+	TokenString
+	TokenRegex
+	TokenWord
+	TokenNumber
+	TokenOperator
+	TokenPipe
+	TokenComma
+	TokenLParen
+	TokenRParen
+	TokenLBracket
+	TokenRBracket
+	TokenLBrace
+	TokenRBrace
+)
+
+var tokenKindNames = map[TokenKind]string{
+	TokenEOF:      "EOF",
+	TokenSpace:    "space",
+	TokenComment:  "comment",
+	TokenString:   "string",
+	TokenRegex:    "regex",
+	TokenWord:     "word",
+	TokenNumber:   "number",
+	TokenOperator: "operator",
+	TokenPipe:     "pipe",
+	TokenComma:    "comma",
+	TokenLParen:   "(",
+	TokenRParen:   ")",
+	TokenLBracket: "[",
+	TokenRBracket: "]",
+	TokenLBrace:   "{",
+	TokenRBrace:   "}",
+}
+
+func (k TokenKind) String() string {
+	if name, ok := tokenKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token is a piece of LQL source. Pos is the byte offset of the token in the
+// source and Text its exact source text.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+}
+
+// operators are matched longest first.
+var operators = []string{"<=>", "=~", "!=", ":=", "<=", ">=", "==", "=", "<", ">", "!", ";", "/"}
+
+// SyntaxError reports a problem in the query at a byte offset.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Pos, e.Msg)
+}
+
+// Tokenize splits the query into tokens. Concatenating the text of the tokens
+// gives back the query.
+func Tokenize(src string) ([]Token, error) {
+	var tokens []Token
+	var expr exprState
+	i := 0
+	for i < len(src) {
+		start := i
+		prev := lastSignificant(tokens)
+		kind, end, err := scanToken(src, i, expr.divisionAfter(prev))
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: src[start:end], Pos: start})
+		expr.update(prev, tokens[len(tokens)-1])
+		i = end
+	}
+	return tokens, nil
+}
+
+// exprState tracks whether the tokenizer is inside an expression, the value
+// of an assignment with := or the arguments of eval. Only there can a slash
+// be a division, everywhere else it starts a regex, as in error /timeout/i.
+type exprState struct {
+	// depth is the parenthesis depth and start the depth the current
+	// expression started at
+	depth int
+	start int
+	in    bool
+}
+
+func (s *exprState) update(prev *Token, tok Token) {
+	switch tok.Kind {
+	case TokenLParen:
+		s.depth++
+		if !s.in && prev != nil && prev.Kind == TokenWord && strings.EqualFold(prev.Text, "eval") {
+			s.in, s.start = true, s.depth
+		}
+	case TokenRParen:
+		s.depth--
+		if s.in && s.depth < s.start {
+			s.in = false
+		}
+	case TokenPipe:
+		if s.in && s.depth <= s.start {
+			s.in = false
+		}
+	case TokenOperator:
+		if !s.in && tok.Text == ":=" {
+			s.in, s.start = true, s.depth
+		}
+	}
+}
+
+// divisionAfter reports whether a slash following prev is a division, which
+// is the case right after an operand inside an expression.
+func (s *exprState) divisionAfter(prev *Token) bool {
+	if !s.in || prev == nil {
+		return false
+	}
+	switch prev.Kind {
+	case TokenWord:
+		return !IsKeyword(prev.Text)
+	case TokenNumber, TokenString, TokenRParen, TokenRBracket:
+		return true
+	}
+	return false
+}
+
+func scanToken(src string, i int, division bool) (TokenKind, int, error) {
+	c := src[i]
+	switch {
+	case isSpace(c):
+		j := i
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+		return TokenSpace, j, nil
+	case strings.HasPrefix(src[i:], "//"):
+		if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+			return TokenComment, i + end, nil
+		}
+		return TokenComment, len(src), nil
+	case strings.HasPrefix(src[i:], "/*"):
+		end := strings.Index(src[i+2:], "*/")
+		if end < 0 {
+			return 0, 0, &SyntaxError{Pos: i, Msg: "unterminated comment"}
+		}
+		return TokenComment, i + 2 + end + 2, nil
+	case c == '"':
+		end, ok := scanDelimited(src, i, '"')
+		if !ok {
+			return 0, 0, &SyntaxError{Pos: i, Msg: "unterminated string"}
+		}
+		return TokenString, end, nil
+	case c == '/' && !division:
+		end, ok := scanDelimited(src, i, '/')
+		if !ok {
+			return 0, 0, &SyntaxError{Pos: i, Msg: "unterminated regex"}
+		}
+		// regex flags such as /foo/i
+		for end < len(src) && isLetter(src[end]) {
+			end++
+		}
+		return TokenRegex, end, nil
+	case c == '|':
+		return TokenPipe, i + 1, nil
+	case c == ',':
+		return TokenComma, i + 1, nil
+	case c == '(':
+		return TokenLParen, i + 1, nil
+	case c == ')':
+		return TokenRParen, i + 1, nil
+	case c == '[':
+		return TokenLBracket, i + 1, nil
+	case c == ']':
+		return TokenRBracket, i + 1, nil
+	case c == '{':
+		return TokenLBrace, i + 1, nil
+	case c == '}':
+		return TokenRBrace, i + 1, nil
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(src[i:], op) {
+			return TokenOperator, i + len(op), nil
+		}
+	}
+
+	j := i
+	for j < len(src) && isWordChar(src, j) {
+		j++
+	}
+	if isNumber(src[i:j]) {
+		return TokenNumber, j, nil
+	}
+	return TokenWord, j, nil
+}
+
+// scanDelimited returns the offset after the closing delimiter of the literal
+// starting at i, honouring backslash escapes.
+func scanDelimited(src string, i int, delim byte) (int, bool) {
+	j := i + 1
+	for j < len(src) {
+		switch src[j] {
+		case '\\':
+			j += 2
+			continue
+		case delim:
+			return j + 1, true
+		}
+		j++
+	}
+	return len(src), false
+}
+
+func lastSignificant(tokens []Token) *Token {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Kind != TokenSpace && tokens[i].Kind != TokenComment {
+			return &tokens[i]
+		}
+	}
+	return nil
+}
+
+// IsKeyword reports whether the word is one of the boolean keywords of LQL.
+func IsKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not":
+		return true
+	}
+	return false
+}
+
+func isWordChar(src string, i int) bool {
+	c := src[i]
+	switch c {
+	case '|', ',', '(', ')', '[', ']', '{', '}', '=', '!', '<', '>', '"', '/', ';':
+		return false
+	case ':':
+		return i+1 >= len(src) || src[i+1] != '='
+	}
+	return !isSpace(c)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' || s[0] == '+' {
+		s = s[1:]
+	}
+	digits, dots := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
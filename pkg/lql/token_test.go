@@ -0,0 +1,83 @@
+package lql_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	kinds := func(tokens []lql.Token) []lql.TokenKind {
+		var k []lql.TokenKind
+		for _, t := range tokens {
+			if t.Kind != lql.TokenSpace {
+				k = append(k, t.Kind)
+			}
+		}
+		return k
+	}
+
+	t.Run("tokenizes a pipeline", func(t *testing.T) {
+		tokens, err := lql.Tokenize(`#type=accesslog status!=200 | groupBy(host, function=count())`)
+		require.NoError(t, err)
+		require.Equal(t, []lql.TokenKind{
+			lql.TokenWord, lql.TokenOperator, lql.TokenWord,
+			lql.TokenWord, lql.TokenOperator, lql.TokenNumber,
+			lql.TokenPipe,
+			lql.TokenWord, lql.TokenLParen, lql.TokenWord, lql.TokenComma,
+			lql.TokenWord, lql.TokenOperator, lql.TokenWord, lql.TokenLParen, lql.TokenRParen,
+			lql.TokenRParen,
+		}, kinds(tokens))
+	})
+
+	t.Run("tells regexes from division", func(t *testing.T) {
+		tokens, err := lql.Tokenize(`url=/api\/v1/i | x := a / 2`)
+		require.NoError(t, err)
+		require.Equal(t, lql.TokenRegex, tokens[2].Kind)
+		require.Equal(t, `/api\/v1/i`, tokens[2].Text)
+		require.Equal(t, lql.Token{Kind: lql.TokenOperator, Text: "/", Pos: 24}, tokens[12])
+	})
+
+	t.Run("reads a slash after a filter term as a regex", func(t *testing.T) {
+		for src, regex := range map[string]string{
+			`status=500 /timeout/`:          `/timeout/`,
+			`error /timeout/i`:              `/timeout/i`,
+			`#type=x /err/i | count()`:      `/err/i`,
+			`"a" /b/`:                       `/b/`,
+			`x := a / 2 | error /time out/`: `/time out/`,
+			`eval(y = a / b) /a|b/`:         `/a|b/`,
+		} {
+			tokens, err := lql.Tokenize(src)
+			require.NoError(t, err, src)
+			var regexes []string
+			for _, tok := range tokens {
+				if tok.Kind == lql.TokenRegex {
+					regexes = append(regexes, tok.Text)
+				}
+			}
+			require.Equal(t, []string{regex}, regexes, src)
+		}
+	})
+
+	t.Run("reads a slash after an operand in eval as a division", func(t *testing.T) {
+		tokens, err := lql.Tokenize(`eval(y = (a + 1) / b)`)
+		require.NoError(t, err)
+		require.Contains(t, tokens, lql.Token{Kind: lql.TokenOperator, Text: "/", Pos: 17})
+	})
+
+	t.Run("keeps comments and strings", func(t *testing.T) {
+		tokens, err := lql.Tokenize("// first\nmsg=\"a | b\" /* note */")
+		require.NoError(t, err)
+		require.Equal(t, []lql.TokenKind{lql.TokenComment, lql.TokenWord, lql.TokenOperator, lql.TokenString, lql.TokenComment}, kinds(tokens))
+	})
+
+	t.Run("reports unterminated literals", func(t *testing.T) {
+		for _, src := range []string{`"abc`, `/abc`, `/* abc`} {
+			_, err := lql.Tokenize(src)
+			var syntaxErr *lql.SyntaxError
+			require.ErrorAs(t, err, &syntaxErr, src)
+			require.Equal(t, 0, syntaxErr.Pos)
+		}
+	})
+}
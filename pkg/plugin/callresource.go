@@ -3,11 +3,14 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
@@ -20,30 +23,124 @@ func (h *Handler) CallResource(ctx context.Context, req *backend.CallResourceReq
 // ResourceHandler handles http calls for resources from the api
 func ResourceHandler(c *humio.Client, settings Settings) http.Handler {
 	r := mux.NewRouter()
-	r.HandleFunc("/repositories", handleRepositories(c, c.ListRepos))
+	r.HandleFunc("/repositories", handleRepositories(c, c.ListRepos, c.ListSearchDomains))
+	r.HandleFunc("/repositories/metadata", handleRepoMetadata(c, c.ListRepoMetadata))
+	r.HandleFunc("/savedSearches", handleSavedSearches(c, c.ListSavedSearches))
+	r.HandleFunc("/format", handleFormat).Methods(http.MethodPost)
+	r.HandleFunc("/ingest", handleIngest(c, settings)).Methods(http.MethodPost)
 
 	return r
 }
 
-func handleRepositories(c *humio.Client, repositories func() ([]string, error)) func(w http.ResponseWriter, req *http.Request) {
+// handleRepositories returns the names of all repositories and views. The
+// optional type parameter limits them to repositories or views, and
+// connections=true returns the search domains with their view connections.
+func handleRepositories(c *humio.Client, repositories func() ([]string, error), searchDomains func() ([]humio.SearchDomain, error)) func(w http.ResponseWriter, req *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
-		authHeaders := map[string]string{
-			backend.OAuthIdentityTokenHeaderName:   req.Header.Get(backend.OAuthIdentityTokenHeaderName),
-			backend.OAuthIdentityIDTokenHeaderName: req.Header.Get(backend.OAuthIdentityIDTokenHeaderName),
+		err := setResourceAuthHeaders(c, req)
+		if err != nil {
+			writeResponse(nil, err, w)
+			return
+		}
+
+		domainType := req.URL.Query().Get("type")
+		withConnections := req.URL.Query().Get("connections") == "true"
+		if domainType == "" && !withConnections {
+			resp, err := repositories()
+			writeResponse(resp, err, w)
+			return
 		}
-		err := c.SetAuthHeaders(authHeaders)
+
+		domains, err := searchDomains()
 		if err != nil {
 			writeResponse(nil, err, w)
 			return
 		}
-		resp, err := repositories()
+		domains = humio.FilterSearchDomains(domains, domainType)
+		if withConnections {
+			writeResponse(domains, nil, w)
+			return
+		}
+		names := []string{}
+		for _, d := range domains {
+			names = append(names, d.Name)
+		}
+		writeResponse(names, nil, w)
+	}
+}
+
+func handleRepoMetadata(c *humio.Client, metadata func() ([]humio.RepositoryMetadata, error)) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		err := setResourceAuthHeaders(c, req)
+		if err != nil {
+			writeResponse(nil, err, w)
+			return
+		}
+		resp, err := metadata()
 		writeResponse(resp, err, w)
 	}
 }
 
+func handleSavedSearches(c *humio.Client, savedSearches func(string) ([]humio.SavedSearch, error)) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		repository := req.URL.Query().Get("repository")
+		if repository == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("repository is required")) //nolint
+			return
+		}
+		err := setResourceAuthHeaders(c, req)
+		if err != nil {
+			writeResponse(nil, err, w)
+			return
+		}
+		resp, err := savedSearches(repository)
+		writeResponse(resp, err, w)
+	}
+}
+
+type formatRequest struct {
+	Query string `json:"query"`
+}
+
+// handleFormat pretty-prints the LQL query in the request body.
+func handleFormat(w http.ResponseWriter, req *http.Request) {
+	var body formatRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error())) //nolint
+		return
+	}
+	formatted, err := lql.Format(body.Query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error())) //nolint
+		return
+	}
+	writeResponse(formatRequest{Query: formatted}, nil, w)
+}
+
+func setResourceAuthHeaders(c *humio.Client, req *http.Request) error {
+	authHeaders := map[string]string{
+		backend.OAuthIdentityTokenHeaderName:   req.Header.Get(backend.OAuthIdentityTokenHeaderName),
+		backend.OAuthIdentityIDTokenHeaderName: req.Header.Get(backend.OAuthIdentityIDTokenHeaderName),
+	}
+	return c.SetAuthHeaders(authHeaders)
+}
+
 func writeResponse(resp interface{}, err error, w http.ResponseWriter) {
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		var apiErr *humio.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= http.StatusBadRequest {
+			status = apiErr.StatusCode
+		}
+		// Grafana takes a 401 from a resource as the user's session expiring,
+		// so LogScale rejecting the data source credentials is a bad gateway
+		if errors.Is(err, humio.ErrUnauthorized) || errors.Is(err, humio.ErrForbidden) {
+			status = http.StatusBadGateway
+		}
+		w.WriteHeader(status)
 		w.Write([]byte(err.Error())) //nolint
 		return
 	}
@@ -57,3 +154,41 @@ func writeResponse(resp interface{}, err error, w http.ResponseWriter) {
 
 	w.Write(b) //nolint
 }
+
+type ingestResponse struct {
+	Ingested int `json:"ingested"`
+}
+
+// handleIngest writes the events in the request body to LogScale with the
+// ingest token, if ingest is enabled and the user has the role it requires.
+func handleIngest(c ingestClient, settings Settings) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		user := backend.PluginConfigFromContext(req.Context()).User
+		if err := settings.checkIngest(user); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(err.Error())) //nolint
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxIngestBytes+1))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error())) //nolint
+			return
+		}
+		batch, err := decodeIngestBatch(body, user)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errIngestTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error())) //nolint
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), ingestTimeout)
+		defer cancel()
+		err = c.Ingest(ctx, settings.IngestToken, []humio.IngestBatch{batch})
+		writeResponse(ingestResponse{Ingested: len(batch.Events)}, err, w)
+	}
+}
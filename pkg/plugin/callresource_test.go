@@ -2,8 +2,15 @@ package plugin_test
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/require"
 )
@@ -19,6 +26,103 @@ func TestCallResource(t *testing.T) {
 	})
 }
 
+func TestResourceHandler(t *testing.T) {
+	handler := plugin.ResourceHandler(&humio.Client{}, plugin.Settings{})
+
+	t.Run("it formats queries", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/format", strings.NewReader(`{"query":"a=1|count()"}`))
+		handler.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"query":"a=1\n| count()"}`, rec.Body.String())
+	})
+
+	t.Run("it returns bad request for invalid queries", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/format", strings.NewReader(`{"query":"count("}`))
+		handler.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestResourceErrors(t *testing.T) {
+	logscale := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"detail":"The token has expired"}`)) //nolint
+	}))
+	defer logscale.Close()
+	address, err := url.Parse(logscale.URL)
+	require.NoError(t, err)
+	client := &humio.Client{URL: address, HTTPClient: logscale.Client()}
+	settings := plugin.Settings{IngestEnabled: true, IngestToken: "ingest-token"}
+
+	t.Run("it maps LogScale auth failures to bad gateway with the LogScale message", func(t *testing.T) {
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{User: &backend.User{Login: "alice", Role: "Editor"}})
+		req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(`{"events":[{"rawstring":"a"}]}`)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		plugin.ResourceHandler(client, settings).ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusBadGateway, rec.Code)
+		require.Contains(t, rec.Body.String(), "The token has expired")
+	})
+}
+
+func TestIngestResource(t *testing.T) {
+	var ingested []string
+	logscale := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/v1/ingest/humio-structured", req.URL.Path)
+		require.Equal(t, "Bearer ingest-token", req.Header.Get("Authorization"))
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		ingested = append(ingested, string(body))
+		w.Write([]byte("{}")) //nolint
+	}))
+	defer logscale.Close()
+	address, err := url.Parse(logscale.URL)
+	require.NoError(t, err)
+	client := &humio.Client{URL: address, HTTPClient: logscale.Client()}
+	settings := plugin.Settings{IngestEnabled: true, IngestToken: "ingest-token"}
+
+	ingest := func(settings plugin.Settings, role string, body string) *httptest.ResponseRecorder {
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{User: &backend.User{Login: "alice", Role: role}})
+		req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		plugin.ResourceHandler(client, settings).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("it ingests events for editors", func(t *testing.T) {
+		rec := ingest(settings, "Editor", `{"events":[{"rawstring":"acknowledged by alice"}]}`)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"ingested":1}`, rec.Body.String())
+		require.Len(t, ingested, 1)
+		require.JSONEq(t, `[{"events":[{"rawstring":"acknowledged by alice","attributes":{"grafanaUser":"alice"}}]}]`, ingested[0])
+	})
+
+	t.Run("it forbids viewers", func(t *testing.T) {
+		rec := ingest(settings, "Viewer", `{"events":[{"rawstring":"a"}]}`)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("it forbids ingest when it is disabled", func(t *testing.T) {
+		rec := ingest(plugin.Settings{}, "Admin", `{"events":[{"rawstring":"a"}]}`)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("it rejects payloads over the limit", func(t *testing.T) {
+		rec := ingest(settings, "Editor", `{"events":[{"rawstring":"`+strings.Repeat("a", 1<<20)+`"}]}`)
+		require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("it rejects invalid payloads", func(t *testing.T) {
+		rec := ingest(settings, "Editor", `{"events":[]}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
 type fakeSender struct{}
 
 func (fn fakeSender) Send(resp *backend.CallResourceResponse) error {
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"errors"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// errorResponse builds a DataResponse for a failed query. LogScale API errors
+// carry their HTTP status through to Grafana and pick the error source from it,
+// everything else falls back to the source attached to the error.
+func errorResponse(err error) backend.DataResponse {
+	var apiErr *humio.APIError
+	if errors.As(err, &apiErr) {
+		return backend.DataResponse{
+			Error:       err,
+			ErrorSource: backend.ErrorSourceFromHTTPStatus(apiErr.StatusCode),
+			Status:      backend.Status(apiErr.StatusCode),
+		}
+	}
+	return backend.ErrorResponseWithErrorSource(err)
+}
+
+// healthCheckMessage turns an error from the health check into a message that
+// tells the user what to fix.
+func healthCheckMessage(err error) string {
+	switch {
+	case errors.Is(err, humio.ErrUnauthorized):
+		return "Authentication failed: the access token or OAuth2 credentials were rejected. Check that they are valid and have not expired."
+	case errors.Is(err, humio.ErrForbidden):
+		return "Authentication failed: the credentials are valid but lack permission. Grant the token access to the repositories you want to query."
+	case errors.Is(err, humio.ErrNotFound):
+		return "Connection failed: the LogScale API was not found at the configured URL. Check the URL and the data source mode."
+	case errors.Is(err, humio.ErrQuotaExceeded):
+		return "Connection failed: LogScale is rate limiting requests. Try again later."
+	case errors.Is(err, humio.ErrServer):
+		return "Connection failed: LogScale returned a server error: " + err.Error()
+	}
+	return "Authentication failed: " + err.Error()
+}
+
+// repositoryNotices turns the errors of the failed repositories of a
+// multi-repository query into warnings shown on the panel.
+func repositoryNotices(err error) []data.Notice {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	notices := make([]data.Notice, 0, len(errs))
+	for _, e := range errs {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     e.Error(),
+		})
+	}
+	return notices
+}
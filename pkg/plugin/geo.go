@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Field names, compared case-insensitively, that hold locations. ipLocation()
+// adds <field>.lat and <field>.lon and worldMap() returns _geohash, so names
+// also match as a suffix after a dot.
+var (
+	latitudeFields  = []string{"latitude", "lat", "_lat"}
+	longitudeFields = []string{"longitude", "lon", "lng", "_lon"}
+	geohashFields   = []string{"geohash", "_geohash"}
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// ConvertToGeo prepares results for the Geomap panel. The first latitude and
+// longitude fields become numeric latitude and longitude fields, and when there
+// are none a geohash field is decoded into them. All other fields, such as the
+// magnitudes returned by worldMap(), are kept.
+func ConvertToGeo(f *data.Frame) (*data.Frame, error) {
+	lat := geoFieldIndex(f, latitudeFields)
+	lon := geoFieldIndex(f, longitudeFields)
+	if lat >= 0 && lon >= 0 {
+		f.Fields[lat] = numericGeoField(f.Fields[lat], "latitude", -90, 90)
+		f.Fields[lon] = numericGeoField(f.Fields[lon], "longitude", -180, 180)
+		return f, nil
+	}
+
+	gh := geoFieldIndex(f, geohashFields)
+	if gh < 0 {
+		return nil, backend.DownstreamError(errors.New("geomap results need latitude and longitude or geohash fields, as returned by ipLocation() or worldMap()"))
+	}
+	geohashes := f.Fields[gh]
+	latitudes := data.NewFieldFromFieldType(data.FieldTypeNullableFloat64, geohashes.Len())
+	longitudes := data.NewFieldFromFieldType(data.FieldTypeNullableFloat64, geohashes.Len())
+	for i := 0; i < geohashes.Len(); i++ {
+		v, ok := geohashes.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if la, lo, ok := decodeGeohash(s); ok {
+			latitudes.Set(i, &la)
+			longitudes.Set(i, &lo)
+		}
+	}
+	latitudes.Name = "latitude"
+	latitudes.Config = geoFieldConfig(-90, 90)
+	longitudes.Name = "longitude"
+	longitudes.Config = geoFieldConfig(-180, 180)
+
+	fields := append([]*data.Field{}, f.Fields[:gh+1]...)
+	fields = append(fields, latitudes, longitudes)
+	f.Fields = append(fields, f.Fields[gh+1:]...)
+	return f, nil
+}
+
+func geoFieldIndex(f *data.Frame, names []string) int {
+	for i, field := range f.Fields {
+		name := strings.ToLower(field.Name)
+		for _, n := range names {
+			if name == n || strings.HasSuffix(name, "."+n) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// numericGeoField returns the coordinates of field as a nullable float64 field,
+// parsing string values. Values that are not coordinates become null.
+func numericGeoField(field *data.Field, name string, minimum float64, maximum float64) *data.Field {
+	out := data.NewFieldFromFieldType(data.FieldTypeNullableFloat64, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		var coordinate float64
+		switch v := v.(type) {
+		case float64:
+			coordinate = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			coordinate = parsed
+		default:
+			continue
+		}
+		if coordinate < minimum || coordinate > maximum {
+			continue
+		}
+		out.Set(i, &coordinate)
+	}
+	out.Name = name
+	out.Labels = field.Labels
+	out.Config = geoFieldConfig(minimum, maximum)
+	return out
+}
+
+func geoFieldConfig(minimum float64, maximum float64) *data.FieldConfig {
+	return &data.FieldConfig{
+		Min: (*data.ConfFloat64)(&minimum),
+		Max: (*data.ConfFloat64)(&maximum),
+	}
+}
+
+// decodeGeohash returns the center of the cell a geohash describes.
+func decodeGeohash(geohash string) (float64, float64, bool) {
+	if geohash == "" {
+		return 0, 0, false
+	}
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	even := true
+	for _, c := range strings.ToLower(geohash) {
+		index := strings.IndexRune(geohashAlphabet, c)
+		if index < 0 {
+			return 0, 0, false
+		}
+		for bit := 4; bit >= 0; bit-- {
+			r := &latRange
+			if even {
+				r = &lonRange
+			}
+			mid := (r[0] + r[1]) / 2
+			if index&(1<<bit) != 0 {
+				r[0] = mid
+			} else {
+				r[1] = mid
+			}
+			even = !even
+		}
+	}
+	return (latRange[0] + latRange[1]) / 2, (lonRange[0] + lonRange[1]) / 2, true
+}
@@ -0,0 +1,54 @@
+package plugin_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeomapFormat(t *testing.T) {
+	t.Run("ipLocation fields become numeric latitude and longitude", func(t *testing.T) {
+		events := []map[string]any{
+			{"client.lat": "55.6761", "client.lon": "12.5683", "client.country": "DK", "_count": "4"},
+			{"client.lat": "", "client.lon": "", "client.country": "", "_count": "2"},
+		}
+		result := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"client.country", "client.lat", "client.lon", "_count"}}}
+
+		frame, err := plugin.BuildDataFrame(humio.FormatGeomap, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, []string{"client.country", "latitude", "longitude", "_count"}, fieldNames(frame))
+		require.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+		lat, ok := frame.Fields[1].ConcreteAt(0)
+		require.True(t, ok)
+		require.InDelta(t, 55.6761, lat, 0.0001)
+		_, ok = frame.Fields[1].ConcreteAt(1)
+		require.False(t, ok)
+		require.Equal(t, 90.0, float64(*frame.Fields[1].Config.Max))
+	})
+	t.Run("worldMap geohashes are decoded and magnitudes kept", func(t *testing.T) {
+		events := []map[string]any{
+			{"_geohash": "u3buv", "_count": "12"},
+			{"_geohash": "9q8yy", "_count": "3"},
+		}
+		result := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"_geohash", "_count"}}}
+
+		frame, err := plugin.BuildDataFrame(humio.FormatGeomap, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, []string{"_geohash", "latitude", "longitude", "_count"}, fieldNames(frame))
+		lat, _ := frame.Fields[1].ConcreteAt(0)
+		lon, _ := frame.Fields[2].ConcreteAt(0)
+		require.InDelta(t, 55.67, lat, 0.05)
+		require.InDelta(t, 12.57, lon, 0.05)
+		magnitude, _ := frame.Fields[3].ConcreteAt(0)
+		require.Equal(t, 12.0, magnitude)
+	})
+	t.Run("results without locations are rejected", func(t *testing.T) {
+		events := []map[string]any{{"host": "a"}}
+		_, err := plugin.BuildDataFrame(humio.FormatGeomap, framestruct.ToDataFrame, humio.QueryResult{Events: events})
+		require.Error(t, err)
+	})
+}
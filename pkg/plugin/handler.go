@@ -2,24 +2,36 @@ package plugin
 
 import (
 	"context"
+	"io"
 	"sync"
+	"time"
 
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
 )
 
+// disposeTimeout bounds how long Dispose waits for streams and query jobs to
+// stop.
+const disposeTimeout = 10 * time.Second
+
 type FrameMarshallerFunc func(string, interface{}, ...framestruct.FramestructOption) (*data.Frame, error)
 type humioClient interface {
 }
 
 type queryRunner interface {
 	Run(humio.Query) ([]humio.QueryResult, error)
-	RunChannel(context.Context, humio.Query, chan humio.StreamingResults)
+	RunChannel(context.Context, humio.Query, chan humio.StreamingResults, chan<- humio.StreamStatus)
+	RunLiveAggregate(context.Context, humio.Query, chan<- humio.QueryResult, chan<- humio.StreamStatus)
 	GetAllRepoNames() ([]string, error)
+	GetSearchDomains() ([]humio.SearchDomain, error)
+	ResolveSavedSearch(humio.Query) (humio.Query, error)
+	GetRepoMetadata() ([]humio.RepositoryMetadata, error)
 	SetAuthHeaders(authHeaders map[string]string) error
 	OauthClientSecretHealthCheck() error
+	Close(context.Context) error
 }
 
 // Handler encapsulates the lifecycle management of the handler components.
@@ -30,9 +42,18 @@ type Handler struct {
 	FrameMarshaller FrameMarshallerFunc
 	Settings        Settings
 
-	// open streams
-	Streams   map[string]data.FrameJSONCache
-	streamsMu sync.RWMutex
+	// last events of each stream by stream key, sent to late joiners
+	Streams *streamStore
+	// upstream live queries shared by the streams with the same key
+	streamMux *streamMultiplexer
+	// events published to the ingest channel, nil unless ingest is enabled
+	ingest *ingestBatcher
+
+	// ctx is cancelled by Dispose to stop the streams of the handler
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	streams sync.WaitGroup
 }
 
 var (
@@ -53,18 +74,93 @@ func NewHandler(
 	settings Settings,
 	opts ...HandlerOption,
 ) *Handler {
+	ctx, cancel := context.WithCancel(context.Background())
 	h := &Handler{
+		ctx:             ctx,
+		cancel:          cancel,
 		Client:          client,
 		QueryRunner:     runner,
 		ResourceHandler: resourceHandler,
 		FrameMarshaller: marshaller,
 		Settings:        settings,
-		Streams:         make(map[string]data.FrameJSONCache),
+		Streams:         settings.newStreamStore(),
 	}
 
 	for _, o := range opts {
 		o(h)
 	}
+	h.streamMux = newStreamMultiplexer(h.Streams)
 
 	return h
 }
+
+// trackStream returns a context for a stream that is also cancelled by
+// Dispose, and reports false once the handler is disposed. The stream must
+// call the returned func once it has stopped.
+func (h *Handler) trackStream(ctx context.Context) (context.Context, func(), bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctx.Err() != nil {
+		cancel()
+		return ctx, func() {}, false
+	}
+	h.streams.Add(1)
+	stopAfter := context.AfterFunc(h.ctx, cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+		h.streams.Done()
+	}, true
+}
+
+// Dispose stops the streams and query jobs of the handler and closes its
+// connections to LogScale. Grafana calls it before replacing the instance
+// when the data source settings change. It waits at most disposeTimeout.
+func (h *Handler) Dispose() {
+	ctx, cancel := context.WithTimeout(context.Background(), disposeTimeout)
+	defer cancel()
+
+	h.mu.Lock()
+	h.cancel()
+	h.mu.Unlock()
+	h.streamMux.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		h.streams.Wait()
+	}()
+	go func() {
+		defer wg.Done()
+		if err := h.QueryRunner.Close(ctx); err != nil {
+			log.DefaultLogger.Warn("Query jobs did not stop before the data source was disposed", "err", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if h.ingest == nil {
+			return
+		}
+		if err := h.ingest.Close(ctx); err != nil {
+			log.DefaultLogger.Warn("Published events were not ingested before the data source was disposed", "err", err)
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.DefaultLogger.Warn("Streams did not stop before the data source was disposed", "err", ctx.Err())
+	}
+
+	if c, ok := h.Client.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.DefaultLogger.Warn("Failed to close the LogScale client", "err", err)
+		}
+	}
+}
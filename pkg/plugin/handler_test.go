@@ -0,0 +1,57 @@
+package plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispose(t *testing.T) {
+	t.Run("it stops running streams and closes the query runner", func(t *testing.T) {
+		handler, tc := setup()
+		req := &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test"}`)}
+		sender := backend.NewStreamSender(&mockStreamPacketSender{})
+
+		errs := make(chan error)
+		go func() {
+			errs <- handler.RunStream(context.Background(), req, sender)
+		}()
+		<-tc.queryRunner.ctx.Done()
+
+		handler.Dispose()
+		select {
+		case err := <-errs:
+			require.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("stream did not stop")
+		}
+		require.True(t, tc.queryRunner.closed)
+	})
+
+	t.Run("it does not start streams once disposed", func(t *testing.T) {
+		handler, _ := setup()
+		handler.Dispose()
+
+		req := &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test"}`)}
+		err := handler.RunStream(context.Background(), req, backend.NewStreamSender(&mockStreamPacketSender{}))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("it sends queued published events", func(t *testing.T) {
+		handler, client := setupIngest()
+		resp, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{
+			PluginContext: backend.PluginContext{User: &backend.User{Login: "editor", Role: "Editor"}},
+			Path:          "ingest",
+			Data:          json.RawMessage(`{"events":[{"rawstring":"a"}]}`),
+		})
+		require.NoError(t, err)
+		require.Equal(t, backend.PublishStreamStatusOK, resp.Status)
+
+		handler.Dispose()
+		require.Len(t, client.Batches(), 1)
+	})
+}
@@ -30,7 +30,7 @@ func (h *Handler) CheckHealth(ctx context.Context, req *backend.CheckHealthReque
 		if err != nil {
 			return &backend.CheckHealthResult{
 				Status:  backend.HealthStatusError,
-				Message: "Authentication failed: " + err.Error(),
+				Message: healthCheckMessage(err),
 			}, nil
 		}
 		message = "Successfully authenticated"
@@ -41,7 +41,7 @@ func (h *Handler) CheckHealth(ctx context.Context, req *backend.CheckHealthReque
 		if err != nil {
 			return &backend.CheckHealthResult{
 				Status:  backend.HealthStatusError,
-				Message: "Authentication failed: " + err.Error(),
+				Message: healthCheckMessage(err),
 			}, nil
 		}
 		message = fmt.Sprintf("Successfully authenticated (%d repositories found)", len(repos))
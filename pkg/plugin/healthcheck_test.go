@@ -3,8 +3,10 @@ package plugin_test
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
 
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/require"
 )
@@ -35,4 +37,30 @@ func TestCheckHealth(t *testing.T) {
 		require.Equal(t, backend.HealthStatusError, res.Status)
 		require.Equal(t, "Authentication failed: some error", res.Message)
 	})
+
+	t.Run("HealthStatusError with an actionable message when the token is rejected", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.viewsErr = &humio.APIError{StatusCode: http.StatusUnauthorized}
+
+		res, _ := handler.CheckHealth(
+			context.Background(),
+			&backend.CheckHealthRequest{},
+		)
+
+		require.Equal(t, backend.HealthStatusError, res.Status)
+		require.Contains(t, res.Message, "credentials were rejected")
+	})
+
+	t.Run("HealthStatusError says the API was not found when LogScale returns 404", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.viewsErr = &humio.APIError{StatusCode: http.StatusNotFound}
+
+		res, _ := handler.CheckHealth(
+			context.Background(),
+			&backend.CheckHealthRequest{},
+		)
+
+		require.Equal(t, backend.HealthStatusError, res.Status)
+		require.Contains(t, res.Message, "API was not found")
+	})
 }
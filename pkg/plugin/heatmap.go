@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	frameTypeHeatmapRows  data.FrameType = "heatmap-rows"
+	frameTypeHeatmapCells data.FrameType = "heatmap-cells"
+)
+
+// heatmapLowerFields and heatmapUpperFields are the names, compared
+// case-insensitively, of the fields holding the bounds of a numeric bucket when
+// the results have one row per time and value bucket.
+var (
+	heatmapLowerFields = []string{"_lower", "lower", "ymin", "ge"}
+	heatmapUpperFields = []string{"_upper", "upper", "ymax", "le"}
+)
+
+// bucketBoundRe matches the last number in a bucket name such as _99, 250 or
+// 10-100, which is taken as the upper bound of the bucket.
+var bucketBoundRe = regexp.MustCompile(`(?:^|[^0-9.])(-?[0-9]+(?:\.[0-9]+)?)`)
+
+// ConvertToHeatmap converts bucketed results into a heatmap frame. Results
+// with bucket boundary fields become heatmap-cells with one row per cell.
+// Other results, such as percentiles over time, become heatmap-rows with one
+// numeric field per bucket ordered by the bound found in its name or label.
+func ConvertToHeatmap(f *data.Frame) (*data.Frame, error) {
+	timeIndex := heatmapTimeField(f)
+	if timeIndex < 0 {
+		return nil, backend.DownstreamError(errors.New("heatmap results need a time field such as _bucket"))
+	}
+	lower := fieldIndexFold(f, heatmapLowerFields)
+	upper := fieldIndexFold(f, heatmapUpperFields)
+	if lower >= 0 || upper >= 0 {
+		return heatmapCells(f, timeIndex, lower, upper)
+	}
+	return heatmapRows(f)
+}
+
+func heatmapCells(f *data.Frame, timeIndex int, lower int, upper int) (*data.Frame, error) {
+	// LogScale buckets are named by their start, which is the left edge of
+	// the cell
+	xMin := f.Fields[timeIndex]
+	xMin.Name = "xMin"
+	cells := data.NewFrame(f.Name, xMin)
+
+	for _, bound := range []struct {
+		index int
+		name  string
+	}{{lower, "yMin"}, {upper, "yMax"}} {
+		if bound.index < 0 {
+			continue
+		}
+		field := f.Fields[bound.index]
+		if !field.Type().Numeric() {
+			return nil, backend.DownstreamError(fmt.Errorf("heatmap bucket field %s is not numeric", field.Name))
+		}
+		field.Name = bound.name
+		cells.Fields = append(cells.Fields, field)
+	}
+
+	count := -1
+	for i, field := range f.Fields {
+		if i == lower || i == upper || !field.Type().Numeric() {
+			continue
+		}
+		if field.Name == "_count" {
+			count = i
+			break
+		}
+		if count < 0 {
+			count = i
+		}
+	}
+	if count < 0 {
+		return nil, backend.DownstreamError(errors.New("heatmap results need a numeric count field"))
+	}
+	countField := f.Fields[count]
+	countField.Name = "count"
+	cells.Fields = append(cells.Fields, countField)
+
+	cells.Meta = &data.FrameMeta{Type: frameTypeHeatmapCells, TypeVersion: data.FrameTypeVersion{0, 1}}
+	return cells, nil
+}
+
+func heatmapRows(f *data.Frame) (*data.Frame, error) {
+	f, err := ConvertToWideFormat(f)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := data.NewFrame(f.Name, f.Fields[heatmapTimeField(f)])
+	type bucket struct {
+		field *data.Field
+		bound float64
+		ok    bool
+	}
+	var buckets []bucket
+	for _, field := range f.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		bound, ok := bucketBound(field)
+		buckets = append(buckets, bucket{field: field, bound: bound, ok: ok})
+	}
+	if len(buckets) == 0 {
+		return nil, backend.DownstreamError(errors.New("heatmap results need at least one numeric field"))
+	}
+
+	// only order the buckets when every one of them has a bound
+	if !slices.ContainsFunc(buckets, func(b bucket) bool { return !b.ok }) {
+		slices.SortStableFunc(buckets, func(a, b bucket) int {
+			switch {
+			case a.bound < b.bound:
+				return -1
+			case a.bound > b.bound:
+				return 1
+			}
+			return 0
+		})
+		for _, b := range buckets {
+			b.field.Name = strconv.FormatFloat(b.bound, 'f', -1, 64)
+			b.field.Labels = nil
+		}
+	}
+	for _, b := range buckets {
+		rows.Fields = append(rows.Fields, b.field)
+	}
+
+	rows.Meta = &data.FrameMeta{Type: frameTypeHeatmapRows, TypeVersion: data.FrameTypeVersion{0, 1}}
+	return rows, nil
+}
+
+// bucketBound returns the upper bound of the bucket a field holds, taken from
+// its only label when it was pivoted from long results, or from its name.
+func bucketBound(field *data.Field) (float64, bool) {
+	name := field.Name
+	if len(field.Labels) == 1 {
+		for _, v := range field.Labels {
+			name = v
+		}
+	}
+	matches := bucketBoundRe.FindAllStringSubmatch(name, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	bound, err := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return bound, true
+}
+
+// heatmapTimeField returns the index of the _bucket field, or of the first time
+// field when there is none.
+func heatmapTimeField(f *data.Frame) int {
+	first := -1
+	for i, field := range f.Fields {
+		if field.Type().Time() {
+			if field.Name == "_bucket" {
+				return i
+			}
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	return first
+}
+
+func fieldIndexFold(f *data.Frame, names []string) int {
+	for _, name := range names {
+		for i, field := range f.Fields {
+			if strings.EqualFold(field.Name, name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,61 @@
+package plugin_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeatmapFormat(t *testing.T) {
+	t.Run("percentiles over time become heatmap rows ordered by bound", func(t *testing.T) {
+		events := []map[string]any{
+			{"_bucket": "1577836800000", "_99": "120", "_50": "10", "_90": "80"},
+			{"_bucket": "1577836860000", "_99": "130", "_50": "12", "_90": "85"},
+		}
+		result := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true}}
+
+		frame, err := plugin.BuildDataFrame(humio.FormatHeatmap, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, data.FrameType("heatmap-rows"), frame.Meta.Type)
+		require.Equal(t, []string{"_bucket", "50", "90", "99"}, fieldNames(frame))
+		require.Equal(t, 2, frame.Rows())
+	})
+	t.Run("long bucket results are pivoted by their series label", func(t *testing.T) {
+		events := []map[string]any{
+			{"_bucket": "1577836800000", "latency": "100-1000", "_count": "3"},
+			{"_bucket": "1577836800000", "latency": "0-100", "_count": "7"},
+			{"_bucket": "1577836860000", "latency": "100-1000", "_count": "1"},
+			{"_bucket": "1577836860000", "latency": "0-100", "_count": "9"},
+		}
+		result := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"_bucket", "latency", "_count"}}}
+
+		frame, err := plugin.BuildDataFrame(humio.FormatHeatmap, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, data.FrameType("heatmap-rows"), frame.Meta.Type)
+		require.Equal(t, []string{"_bucket", "100", "1000"}, fieldNames(frame))
+	})
+	t.Run("bucket boundary fields become heatmap cells", func(t *testing.T) {
+		events := []map[string]any{
+			{"_bucket": "1577836800000", "_lower": "0", "_upper": "100", "_count": "7"},
+			{"_bucket": "1577836800000", "_lower": "100", "_upper": "1000", "_count": "3"},
+		}
+		result := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"_bucket", "_lower", "_upper", "_count"}}}
+
+		frame, err := plugin.BuildDataFrame(humio.FormatHeatmap, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, data.FrameType("heatmap-cells"), frame.Meta.Type)
+		require.Equal(t, []string{"xMin", "yMin", "yMax", "count"}, fieldNames(frame))
+		require.Equal(t, 2, frame.Rows())
+	})
+	t.Run("results without a time field are rejected", func(t *testing.T) {
+		events := []map[string]any{{"host": "a", "_count": "1"}}
+		result := humio.QueryResult{Events: events}
+
+		_, err := plugin.BuildDataFrame(humio.FormatHeatmap, framestruct.ToDataFrame, result)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	// ingestChannelPath is the live channel events are published to
+	ingestChannelPath = "ingest"
+	// maxIngestEvents and maxIngestBytes limit a single publish or request
+	maxIngestEvents = 1000
+	maxIngestBytes  = 1 << 20
+	// ingestFlushInterval is how long published events are batched before
+	// they are sent to LogScale
+	ingestFlushInterval = time.Second
+	ingestTimeout       = 30 * time.Second
+	// ingestUserAttribute records the Grafana user that wrote an event
+	ingestUserAttribute  = "grafanaUser"
+	defaultIngestMinRole = "Editor"
+)
+
+var (
+	errIngestDisabled  = errors.New("ingest is not enabled for this data source")
+	errIngestForbidden = errors.New("your Grafana role is not allowed to ingest events")
+	errIngestTooLarge  = fmt.Errorf("ingest payload is larger than %d bytes", maxIngestBytes)
+)
+
+// ingestRoles ranks the Grafana organization roles for IngestMinRole.
+var ingestRoles = map[string]int{"Viewer": 1, "Editor": 2, "Admin": 3}
+
+type ingestClient interface {
+	Ingest(ctx context.Context, token string, batches []humio.IngestBatch) error
+}
+
+// checkIngest returns an error unless ingest is enabled and the user has at
+// least the minimum role. Unknown roles are never allowed.
+func (s Settings) checkIngest(user *backend.User) error {
+	if !s.IngestEnabled || s.IngestToken == "" {
+		return errIngestDisabled
+	}
+	minRole := s.IngestMinRole
+	if minRole == "" {
+		minRole = defaultIngestMinRole
+	}
+	required, ok := ingestRoles[minRole]
+	if !ok || user == nil {
+		return errIngestForbidden
+	}
+	if ingestRoles[user.Role] < required {
+		return errIngestForbidden
+	}
+	return nil
+}
+
+// decodeIngestBatch parses and checks the events of a publish or request and
+// records the user on every event.
+func decodeIngestBatch(body []byte, user *backend.User) (humio.IngestBatch, error) {
+	if len(body) > maxIngestBytes {
+		return humio.IngestBatch{}, errIngestTooLarge
+	}
+	var batch humio.IngestBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return humio.IngestBatch{}, fmt.Errorf("invalid ingest payload: %w", err)
+	}
+	switch {
+	case len(batch.Events) == 0:
+		return humio.IngestBatch{}, errors.New("ingest payload has no events")
+	case len(batch.Events) > maxIngestEvents:
+		return humio.IngestBatch{}, fmt.Errorf("ingest payload has more than %d events", maxIngestEvents)
+	}
+	for i, e := range batch.Events {
+		if e.RawString == "" && len(e.Attributes) == 0 {
+			return humio.IngestBatch{}, fmt.Errorf("event %d has neither rawstring nor attributes", i)
+		}
+		if e.Attributes == nil {
+			e.Attributes = map[string]any{}
+		}
+		e.Attributes[ingestUserAttribute] = user.Login
+		batch.Events[i] = e
+	}
+	return batch, nil
+}
+
+// ingestBatcher collects published events and sends them to LogScale every
+// ingestFlushInterval, or sooner once maxIngestEvents are waiting.
+type ingestBatcher struct {
+	client ingestClient
+	token  string
+
+	mu      sync.Mutex
+	pending []humio.IngestBatch
+	count   int
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newIngestBatcher(client ingestClient, token string) *ingestBatcher {
+	b := &ingestBatcher{
+		client: client,
+		token:  token,
+		full:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add queues the batch to be sent.
+func (b *ingestBatcher) Add(batch humio.IngestBatch) {
+	b.mu.Lock()
+	b.pending = append(b.pending, batch)
+	b.count += len(batch.Events)
+	full := b.count >= maxIngestEvents
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends the queued events and stops the batcher, waiting until ctx is
+// done for the events to be sent.
+func (b *ingestBatcher) Close(ctx context.Context) error {
+	b.once.Do(func() { close(b.stop) })
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *ingestBatcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(ingestFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			b.flush()
+			return
+		case <-ticker.C:
+			b.flush()
+		case <-b.full:
+			b.flush()
+		}
+	}
+}
+
+func (b *ingestBatcher) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	count := b.count
+	b.pending = nil
+	b.count = 0
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingestTimeout)
+	defer cancel()
+	if err := b.client.Ingest(ctx, b.token, pending); err != nil {
+		log.DefaultLogger.Error("Failed to ingest published events", "events", count, "err", err)
+	}
+}
+
+// WithIngestClient sends events published to the ingest channel to LogScale
+// with client when ingest is enabled in the settings.
+func WithIngestClient(client ingestClient) HandlerOption {
+	return func(h *Handler) {
+		if h.Settings.IngestEnabled && h.Settings.IngestToken != "" {
+			h.ingest = newIngestBatcher(client, h.Settings.IngestToken)
+		}
+	}
+}
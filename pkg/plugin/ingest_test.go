@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIngestClient struct {
+	mu      sync.Mutex
+	token   string
+	batches []humio.IngestBatch
+	err     error
+}
+
+func (c *fakeIngestClient) Ingest(_ context.Context, token string, batches []humio.IngestBatch) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.batches = append(c.batches, batches...)
+	return c.err
+}
+
+func TestCheckIngest(t *testing.T) {
+	enabled := Settings{IngestEnabled: true, IngestToken: "token"}
+	editor := &backend.User{Login: "editor", Role: "Editor"}
+
+	require.ErrorIs(t, Settings{IngestToken: "token"}.checkIngest(editor), errIngestDisabled)
+	require.ErrorIs(t, Settings{IngestEnabled: true}.checkIngest(editor), errIngestDisabled)
+	require.NoError(t, enabled.checkIngest(editor))
+	require.NoError(t, enabled.checkIngest(&backend.User{Role: "Admin"}))
+	require.ErrorIs(t, enabled.checkIngest(&backend.User{Role: "Viewer"}), errIngestForbidden)
+	require.ErrorIs(t, enabled.checkIngest(&backend.User{Role: "None"}), errIngestForbidden)
+	require.ErrorIs(t, enabled.checkIngest(nil), errIngestForbidden)
+
+	adminOnly := enabled
+	adminOnly.IngestMinRole = "Admin"
+	require.ErrorIs(t, adminOnly.checkIngest(editor), errIngestForbidden)
+
+	unknown := enabled
+	unknown.IngestMinRole = "Owner"
+	require.ErrorIs(t, unknown.checkIngest(&backend.User{Role: "Admin"}), errIngestForbidden)
+}
+
+func TestDecodeIngestBatch(t *testing.T) {
+	user := &backend.User{Login: "alice", Role: "Editor"}
+
+	batch, err := decodeIngestBatch([]byte(`{"tags":{"source":"grafana"},"events":[{"rawstring":"acknowledged","attributes":{"grafanaUser":"mallory"}}]}`), user)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"source": "grafana"}, batch.Tags)
+	require.Equal(t, "alice", batch.Events[0].Attributes[ingestUserAttribute])
+
+	for name, body := range map[string]string{
+		"invalid json": `{`,
+		"no events":    `{"events":[]}`,
+		"empty event":  `{"events":[{}]}`,
+		"too many":     `{"events":[` + strings.Repeat(`{"rawstring":"a"},`, maxIngestEvents) + `{"rawstring":"a"}]}`,
+	} {
+		_, err := decodeIngestBatch([]byte(body), user)
+		require.Error(t, err, name)
+	}
+
+	_, err = decodeIngestBatch(make([]byte, maxIngestBytes+1), user)
+	require.ErrorIs(t, err, errIngestTooLarge)
+}
+
+func TestIngestBatcher(t *testing.T) {
+	client := &fakeIngestClient{}
+	b := newIngestBatcher(client, "token")
+	b.Add(humio.IngestBatch{Events: []humio.IngestEvent{{RawString: "a"}}})
+	b.Add(humio.IngestBatch{Events: []humio.IngestEvent{{RawString: "b"}}})
+	require.NoError(t, b.Close(context.Background()))
+
+	require.Equal(t, "token", client.token)
+	require.Len(t, client.batches, 2)
+}
@@ -0,0 +1,124 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// queryInterval returns the interval Grafana chose for the panel, falling back
+// to the time range divided by MaxDataPoints when no interval was sent.
+func queryInterval(q backend.DataQuery) time.Duration {
+	interval := q.Interval
+	if q.MaxDataPoints > 0 {
+		minInterval := q.TimeRange.Duration() / time.Duration(q.MaxDataPoints)
+		if interval < minInterval {
+			interval = minInterval
+		}
+	}
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
+
+// formatDuration formats d in the largest LogScale time unit that represents
+// it exactly, e.g. 1m, 30s or 250ms.
+func formatDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	units := []struct {
+		suffix string
+		ms     int64
+	}{
+		{"d", int64(24 * time.Hour / time.Millisecond)},
+		{"h", int64(time.Hour / time.Millisecond)},
+		{"m", int64(time.Minute / time.Millisecond)},
+		{"s", int64(time.Second / time.Millisecond)},
+	}
+	for _, u := range units {
+		if ms >= u.ms && ms%u.ms == 0 {
+			return fmt.Sprintf("%d%s", ms/u.ms, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dms", ms)
+}
+
+var macroRe = regexp.MustCompile(`\$__(\w+)`)
+
+type macroFunc func(query humio.Query, q backend.DataQuery) string
+
+// macros maps macro names, without the $__ prefix, to their expansion.
+var macros = map[string]macroFunc{
+	"from": func(_ humio.Query, q backend.DataQuery) string {
+		return strconv.FormatInt(q.TimeRange.From.UnixMilli(), 10)
+	},
+	"to": func(_ humio.Query, q backend.DataQuery) string {
+		return strconv.FormatInt(q.TimeRange.To.UnixMilli(), 10)
+	},
+	"interval": func(_ humio.Query, q backend.DataQuery) string {
+		return formatDuration(queryInterval(q))
+	},
+	"interval_ms": func(_ humio.Query, q backend.DataQuery) string {
+		return strconv.FormatInt(queryInterval(q).Milliseconds(), 10)
+	},
+	"range": func(_ humio.Query, q backend.DataQuery) string {
+		return formatDuration(q.TimeRange.Duration())
+	},
+	"range_ms": func(_ humio.Query, q backend.DataQuery) string {
+		return strconv.FormatInt(q.TimeRange.Duration().Milliseconds(), 10)
+	},
+	"range_s": func(_ humio.Query, q backend.DataQuery) string {
+		return strconv.FormatInt(int64(q.TimeRange.Duration().Seconds()), 10)
+	},
+	"timezone": func(query humio.Query, _ backend.DataQuery) string {
+		return formatTimezone(query.TimezoneOffset)
+	},
+}
+
+// ExpandMacros replaces the $__ macros in the LQL of the query with values
+// taken from the data query, so queries that never pass through frontend
+// interpolation, such as alert rules, can use them too. Macros in strings,
+// regexes and comments are left as they are, as are names that are not macros
+// here, such as $__rate_interval. Queries that cannot be tokenized are returned
+// unchanged and left for LogScale to report.
+func ExpandMacros(query humio.Query, q backend.DataQuery) string {
+	tokens, err := lql.Tokenize(query.LSQL)
+	if err != nil {
+		return query.LSQL
+	}
+	var b strings.Builder
+	for _, t := range tokens {
+		if t.Kind != lql.TokenWord {
+			b.WriteString(t.Text)
+			continue
+		}
+		b.WriteString(macroRe.ReplaceAllStringFunc(t.Text, func(m string) string {
+			if macro, ok := macros[m[len("$__"):]]; ok {
+				return macro(query, q)
+			}
+			return m
+		}))
+	}
+	return b.String()
+}
+
+// formatTimezone formats an offset in minutes east of UTC as +hh:mm. A missing
+// offset is UTC.
+func formatTimezone(offset *int) string {
+	if offset == nil {
+		return "UTC"
+	}
+	sign := "+"
+	minutes := *offset
+	if minutes < 0 {
+		sign = "-"
+		minutes = -minutes
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, minutes/60, minutes%60)
+}
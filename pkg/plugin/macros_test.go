@@ -0,0 +1,99 @@
+package plugin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntervalMacros(t *testing.T) {
+	timeRange := backend.TimeRange{
+		From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC),
+	}
+
+	run := func(t *testing.T, q backend.DataQuery) string {
+		handler, tc := setup()
+		q.RefID = "A"
+		q.TimeRange = timeRange
+		_, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{q}})
+		require.NoError(t, err)
+		return tc.queryRunner.req.LSQL
+	}
+
+	t.Run("expands interval macros", func(t *testing.T) {
+		lsql := run(t, backend.DataQuery{
+			Interval: 30 * time.Second,
+			JSON:     []byte(`{"repository":"repo","lsql":"timeChart(span=$__interval) | x := $__interval_ms"}`),
+		})
+		require.Equal(t, "timeChart(span=30s) | x := 30000", lsql)
+	})
+
+	t.Run("uses max data points when the interval is smaller", func(t *testing.T) {
+		lsql := run(t, backend.DataQuery{
+			Interval:      time.Second,
+			MaxDataPoints: 60,
+			JSON:          []byte(`{"repository":"repo","lsql":"timeChart(span=$__interval)"}`),
+		})
+		require.Equal(t, "timeChart(span=1m)", lsql)
+	})
+
+	t.Run("injects a span when autoSpan is enabled", func(t *testing.T) {
+		lsql := run(t, backend.DataQuery{
+			Interval: 2 * time.Hour,
+			JSON:     []byte(`{"repository":"repo","lsql":"timeChart()","autoSpan":true}`),
+		})
+		require.Equal(t, "timeChart(span=2h)", lsql)
+	})
+
+	t.Run("does not inject a span by default", func(t *testing.T) {
+		lsql := run(t, backend.DataQuery{
+			Interval: time.Minute,
+			JSON:     []byte(`{"repository":"repo","lsql":"timeChart()"}`),
+		})
+		require.Equal(t, "timeChart()", lsql)
+	})
+}
+
+func TestExpandMacros(t *testing.T) {
+	q := backend.DataQuery{
+		Interval: time.Minute,
+		TimeRange: backend.TimeRange{
+			From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	offset := -330
+
+	tests := []struct {
+		name     string
+		query    humio.Query
+		expected string
+	}{
+		{name: "from and to", query: humio.Query{LSQL: "start=$__from end=$__to"}, expected: "start=1577836800000 end=1577923200000"},
+		{name: "interval", query: humio.Query{LSQL: "$__interval $__interval_ms"}, expected: "1m 60000"},
+		{name: "range", query: humio.Query{LSQL: "$__range $__range_ms $__range_s"}, expected: "1d 86400000 86400"},
+		{name: "default timezone", query: humio.Query{LSQL: "timezone=$__timezone"}, expected: "timezone=UTC"},
+		{name: "timezone offset", query: humio.Query{LSQL: "timezone=$__timezone", TimezoneOffset: &offset}, expected: "timezone=-05:30"},
+		{name: "no macros", query: humio.Query{LSQL: "count()"}, expected: "count()"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, plugin.ExpandMacros(tt.query, q))
+		})
+	}
+
+	t.Run("unknown macros are left unchanged", func(t *testing.T) {
+		lsql := plugin.ExpandMacros(humio.Query{LSQL: "$__from $__foo $__rate_interval"}, q)
+		require.Equal(t, "1577836800000 $__foo $__rate_interval", lsql)
+	})
+	t.Run("macros in strings, regexes and comments are left unchanged", func(t *testing.T) {
+		lsql := plugin.ExpandMacros(humio.Query{LSQL: `msg="since $__from" url=/$__to/ // until $__to` + "\n| bucket(span=$__interval)"}, q)
+		require.Equal(t, `msg="since $__from" url=/$__to/ // until $__to`+"\n| bucket(span=1m)", lsql)
+	})
+}
@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// RepoMetadataFrame builds a table frame with one row per repository or view.
+func RepoMetadataFrame(metadata []humio.RepositoryMetadata) *data.Frame {
+	names := make([]string, len(metadata))
+	types := make([]string, len(metadata))
+	descriptions := make([]string, len(metadata))
+	timeRetention := make([]*float64, len(metadata))
+	ingestRetention := make([]*float64, len(metadata))
+	storageRetention := make([]*float64, len(metadata))
+	compressed := make([]*int64, len(metadata))
+	uncompressed := make([]*int64, len(metadata))
+
+	for i, m := range metadata {
+		names[i] = m.Name
+		types[i] = m.Type
+		descriptions[i] = m.Description
+		timeRetention[i] = m.TimeBasedRetention
+		ingestRetention[i] = m.IngestSizeBasedRetention
+		storageRetention[i] = m.StorageSizeBasedRetention
+		compressed[i] = m.CompressedByteSize
+		uncompressed[i] = m.UncompressedByteSize
+	}
+
+	return data.NewFrame("repositories",
+		data.NewField("name", nil, names),
+		data.NewField("type", nil, types),
+		data.NewField("description", nil, descriptions),
+		data.NewField("timeBasedRetention", nil, timeRetention).SetConfig(&data.FieldConfig{DisplayName: "Retention", Unit: "d"}),
+		data.NewField("ingestSizeBasedRetention", nil, ingestRetention).SetConfig(&data.FieldConfig{DisplayName: "Ingest size retention", Unit: "decgbytes"}),
+		data.NewField("storageSizeBasedRetention", nil, storageRetention).SetConfig(&data.FieldConfig{DisplayName: "Storage size retention", Unit: "decgbytes"}),
+		data.NewField("compressedByteSize", nil, compressed).SetConfig(&data.FieldConfig{DisplayName: "Compressed size", Unit: "decbytes"}),
+		data.NewField("uncompressedByteSize", nil, uncompressed).SetConfig(&data.FieldConfig{DisplayName: "Uncompressed size", Unit: "decbytes"}),
+	).SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeTable})
+}
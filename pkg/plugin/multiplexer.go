@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// subscriberBuffer is the number of events buffered for each subscriber of a
+// shared stream. A subscriber whose buffer is full is disconnected, so it does
+// not hold up the other subscribers.
+const subscriberBuffer = 256
+
+var (
+	errSubscriberTooSlow = errors.New("live tail could not keep up with the events and was disconnected")
+	errUpstreamStopped   = errors.New("live tail stopped")
+)
+
+// streamKey identifies an upstream live query. Subscribers with the same key
+// share one LogScale connection. Identity separates users when their own
+// credentials are forwarded to LogScale.
+type streamKey struct {
+	Repository string
+	LSQL       string
+	Identity   string
+}
+
+func newStreamKey(qr humio.Query, settings Settings, user *backend.User) streamKey {
+	key := streamKey{Repository: qr.Repository, LSQL: qr.LSQL}
+	if settings.OAuthPassThru && user != nil {
+		key.Identity = user.Login
+	}
+	return key
+}
+
+// String returns an opaque form of the key for use in maps such as
+// Handler.Streams.
+func (k streamKey) String() string {
+	sum := sha256.Sum256([]byte(k.Repository + "\x00" + k.LSQL + "\x00" + k.Identity))
+	return hex.EncodeToString(sum[:])
+}
+
+type streamRunner interface {
+	RunChannel(context.Context, humio.Query, chan humio.StreamingResults, chan<- humio.StreamStatus)
+}
+
+// streamMultiplexer runs one upstream live query per key and fans its events
+// out to every subscriber. The upstream is closed when its last subscriber
+// leaves. Events are also kept in store, when set, for late joiners.
+type streamMultiplexer struct {
+	mu      sync.Mutex
+	streams map[streamKey]*sharedStream
+	store   *streamStore
+}
+
+func newStreamMultiplexer(store *streamStore) *streamMultiplexer {
+	return &streamMultiplexer{streams: map[streamKey]*sharedStream{}, store: store}
+}
+
+type sharedStream struct {
+	cancel      context.CancelFunc
+	subscribers map[*streamSubscriber]struct{}
+}
+
+// streamSubscriber receives the events and connection changes of a shared
+// stream until it unsubscribes or Closed is closed. Closed is closed when the
+// multiplexer disconnects the subscriber, Err then tells why.
+type streamSubscriber struct {
+	Events chan humio.StreamingResults
+	Status chan humio.StreamStatus
+	Closed chan struct{}
+	Err    error
+}
+
+// Subscribe joins the stream for key, starting it with runner when nobody is
+// subscribed yet. The returned func leaves the stream and must be called once.
+func (m *streamMultiplexer) Subscribe(key streamKey, qr humio.Query, runner streamRunner) (*streamSubscriber, func()) {
+	sub := &streamSubscriber{
+		Events: make(chan humio.StreamingResults, subscriberBuffer),
+		Status: make(chan humio.StreamStatus, 1),
+		Closed: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	s, ok := m.streams[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		s = &sharedStream{cancel: cancel, subscribers: map[*streamSubscriber]struct{}{}}
+		m.streams[key] = s
+
+		events := make(chan humio.StreamingResults)
+		status := make(chan humio.StreamStatus)
+		runner.RunChannel(ctx, qr, events, status)
+		go m.fanOut(ctx, key, s, events, status)
+	}
+	s.subscribers[sub] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			delete(s.subscribers, sub)
+			m.stopIfUnused(key, s)
+		})
+	}
+}
+
+// fanOut copies events and status changes from the upstream to every
+// subscriber until the upstream is cancelled or fails. Sends never block, so
+// a slow subscriber cannot hold up the others.
+func (m *streamMultiplexer) fanOut(ctx context.Context, key streamKey, s *sharedStream, events chan humio.StreamingResults, status chan humio.StreamStatus) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if m.store != nil {
+				m.store.Append(key.String(), e)
+			}
+			for _, sub := range m.subscribers(s) {
+				select {
+				case sub.Events <- e:
+				default:
+					m.disconnect(key, s, sub, errSubscriberTooSlow)
+				}
+			}
+		case st := <-status:
+			if st.State == humio.StreamStateFailed {
+				// later subscribers start a new upstream instead of joining this one
+				err := st.Err
+				if err == nil {
+					err = errUpstreamStopped
+				}
+				for _, sub := range m.subscribers(s) {
+					m.disconnect(key, s, sub, err)
+				}
+				return
+			}
+			for _, sub := range m.subscribers(s) {
+				select {
+				case sub.Status <- st:
+				default:
+					// the subscriber has yet to read the previous change
+				}
+			}
+		}
+	}
+}
+
+// disconnect removes sub from the stream and closes it with err.
+func (m *streamMultiplexer) disconnect(key streamKey, s *sharedStream, sub *streamSubscriber, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := s.subscribers[sub]; !ok {
+		return
+	}
+	delete(s.subscribers, sub)
+	sub.Err = err
+	close(sub.Closed)
+	m.stopIfUnused(key, s)
+}
+
+// stopIfUnused stops the upstream of s once it has no subscribers. m.mu must
+// be held.
+func (m *streamMultiplexer) stopIfUnused(key streamKey, s *sharedStream) {
+	if len(s.subscribers) == 0 {
+		s.cancel()
+		if m.streams[key] == s {
+			delete(m.streams, key)
+		}
+	}
+}
+
+func (m *streamMultiplexer) subscribers(s *sharedStream) []*streamSubscriber {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]*streamSubscriber, 0, len(s.subscribers))
+	for sub := range s.subscribers {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// Close stops every upstream stream. Subscribers stop receiving events and
+// are left to unsubscribe.
+func (m *streamMultiplexer) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, s := range m.streams {
+		s.cancel()
+		delete(m.streams, key)
+	}
+}
+
+// Len returns the number of upstream streams that are running.
+func (m *streamMultiplexer) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.streams)
+}
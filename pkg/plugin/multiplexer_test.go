@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+)
+
+// channelRunner starts a fake upstream per RunChannel call and exposes its
+// channel so the test can send events.
+type channelRunner struct {
+	mu       sync.Mutex
+	calls    int
+	upstream chan humio.StreamingResults
+	status   chan<- humio.StreamStatus
+	ctx      context.Context
+}
+
+func (r *channelRunner) RunChannel(ctx context.Context, _ humio.Query, c chan humio.StreamingResults, status chan<- humio.StreamStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	r.upstream = c
+	r.status = status
+	r.ctx = ctx
+}
+
+func TestStreamMultiplexer(t *testing.T) {
+	t.Run("subscribers of the same key share one upstream", func(t *testing.T) {
+		m := newStreamMultiplexer(nil)
+		runner := &channelRunner{}
+		key := streamKey{Repository: "repo", LSQL: "#type=accesslog"}
+
+		first, leaveFirst := m.Subscribe(key, humio.Query{}, runner)
+		second, leaveSecond := m.Subscribe(key, humio.Query{}, runner)
+		require.Equal(t, 1, runner.calls)
+
+		runner.upstream <- humio.StreamingResults{"@id": "a"}
+		require.Equal(t, "a", (<-first.Events)["@id"])
+		require.Equal(t, "a", (<-second.Events)["@id"])
+
+		leaveFirst()
+		require.NoError(t, runner.ctx.Err())
+		leaveSecond()
+		require.ErrorIs(t, runner.ctx.Err(), context.Canceled)
+		require.Equal(t, 0, m.Len())
+	})
+	t.Run("different keys use their own upstream", func(t *testing.T) {
+		m := newStreamMultiplexer(nil)
+		runner := &channelRunner{}
+
+		_, leaveFirst := m.Subscribe(streamKey{Repository: "repo", LSQL: "a"}, humio.Query{}, runner)
+		defer leaveFirst()
+		_, leaveSecond := m.Subscribe(streamKey{Repository: "repo", LSQL: "b"}, humio.Query{}, runner)
+		defer leaveSecond()
+		require.Equal(t, 2, runner.calls)
+		require.Equal(t, 2, m.Len())
+	})
+	t.Run("a slow subscriber is disconnected without holding up the others", func(t *testing.T) {
+		m := newStreamMultiplexer(nil)
+		runner := &channelRunner{}
+		key := streamKey{Repository: "repo", LSQL: "x"}
+
+		slow, leaveSlow := m.Subscribe(key, humio.Query{}, runner)
+		defer leaveSlow()
+		fast, leaveFast := m.Subscribe(key, humio.Query{}, runner)
+		defer leaveFast()
+
+		received := make(chan int)
+		go func() {
+			n := 0
+			for n < subscriberBuffer+1 {
+				<-fast.Events
+				n++
+			}
+			received <- n
+		}()
+		for range subscriberBuffer + 1 {
+			runner.upstream <- humio.StreamingResults{"@id": "a"}
+		}
+
+		<-slow.Closed
+		require.ErrorIs(t, slow.Err, errSubscriberTooSlow)
+		require.Equal(t, subscriberBuffer+1, <-received)
+		require.NoError(t, runner.ctx.Err())
+	})
+	t.Run("a failed upstream is not joined by later subscribers", func(t *testing.T) {
+		m := newStreamMultiplexer(nil)
+		runner := &channelRunner{}
+		key := streamKey{Repository: "repo", LSQL: "x"}
+
+		sub, leave := m.Subscribe(key, humio.Query{}, runner)
+		defer leave()
+		runner.status <- humio.StreamStatus{State: humio.StreamStateFailed, Err: humio.ErrUnauthorized}
+
+		<-sub.Closed
+		require.ErrorIs(t, sub.Err, humio.ErrUnauthorized)
+		require.Equal(t, 0, m.Len())
+
+		_, leaveNext := m.Subscribe(key, humio.Query{}, runner)
+		defer leaveNext()
+		require.Equal(t, 2, runner.calls)
+	})
+	t.Run("users only share streams when the datasource credentials are used", func(t *testing.T) {
+		qr := humio.Query{Repository: "repo", LSQL: "x"}
+		alice, bob := &backend.User{Login: "alice"}, &backend.User{Login: "bob"}
+
+		require.Equal(t, newStreamKey(qr, Settings{}, alice), newStreamKey(qr, Settings{}, bob))
+		require.NotEqual(t, newStreamKey(qr, Settings{OAuthPassThru: true}, alice), newStreamKey(qr, Settings{OAuthPassThru: true}, bob))
+	})
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// nodeGraphShapes are the result shapes recognized when the query does not
+// name the source and target fields. NGSIEM process events link a process to
+// its parent, and sankey() returns source and target.
+var nodeGraphShapes = []humio.NodeGraphOptions{
+	{SourceField: "ParentProcessId", TargetField: "TargetProcessId", TitleField: "ImageFileName", SubtitleField: "CommandLine"},
+	{SourceField: "source", TargetField: "target"},
+	{SourceField: "from", TargetField: "to"},
+}
+
+// nodeGraphMetricFields are used as the metric when none is configured.
+var nodeGraphMetricFields = []string{"_count", "weight", "_weight"}
+
+// BuildNodeGraphFrames converts results into the nodes and edges frames of the
+// node graph panel. Events without a source add their target as a root node.
+func BuildNodeGraphFrames(opts humio.NodeGraphOptions, r humio.QueryResult) ([]*data.Frame, error) {
+	opts = resolveNodeGraphOptions(opts, r.Events)
+	if opts.SourceField == "" || opts.TargetField == "" {
+		return nil, backend.DownstreamError(errors.New("node graph results need source and target fields; set them in the query options"))
+	}
+
+	var nodeIDs, nodeTitles, nodeSubtitles []string
+	var nodeMetrics []any
+	nodeIndex := map[string]int{}
+	addNode := func(id string, event map[string]any) {
+		i, ok := nodeIndex[id]
+		if !ok {
+			i = len(nodeIDs)
+			nodeIndex[id] = i
+			nodeIDs = append(nodeIDs, id)
+			nodeTitles = append(nodeTitles, id)
+			nodeSubtitles = append(nodeSubtitles, "")
+			nodeMetrics = append(nodeMetrics, nil)
+		}
+		if event == nil {
+			return
+		}
+		if title := eventString(event, opts.TitleField); title != "" {
+			nodeTitles[i] = title
+		}
+		if subtitle := eventString(event, opts.SubtitleField); subtitle != "" {
+			nodeSubtitles[i] = subtitle
+		}
+		if v, ok := event[opts.MetricField]; ok && v != nil {
+			nodeMetrics[i] = v
+		}
+	}
+
+	var edgeIDs, edgeSources, edgeTargets []string
+	var edgeMetrics []any
+	edgeSeen := map[string]bool{}
+	for _, event := range r.Events {
+		source := eventString(event, opts.SourceField)
+		target := eventString(event, opts.TargetField)
+		if target == "" {
+			continue
+		}
+		if source != "" {
+			addNode(source, nil)
+		}
+		addNode(target, event)
+		if source == "" {
+			continue
+		}
+		id := source + "->" + target
+		if edgeSeen[id] {
+			continue
+		}
+		edgeSeen[id] = true
+		edgeIDs = append(edgeIDs, id)
+		edgeSources = append(edgeSources, source)
+		edgeTargets = append(edgeTargets, target)
+		edgeMetrics = append(edgeMetrics, event[opts.MetricField])
+	}
+
+	nodes := data.NewFrame("nodes",
+		data.NewField("id", nil, nodeIDs),
+		data.NewField("title", nil, nodeTitles),
+	)
+	if opts.SubtitleField != "" {
+		nodes.Fields = append(nodes.Fields, data.NewField("subtitle", nil, nodeSubtitles))
+	}
+	edges := data.NewFrame("edges",
+		data.NewField("id", nil, edgeIDs),
+		data.NewField("source", nil, edgeSources),
+		data.NewField("target", nil, edgeTargets),
+	)
+	if opts.MetricField != "" {
+		nodes.Fields = append(nodes.Fields, metricField("mainstat", opts.MetricField, nodeMetrics))
+		edges.Fields = append(edges.Fields, metricField("mainstat", opts.MetricField, edgeMetrics))
+	}
+
+	for _, f := range []*data.Frame{nodes, edges} {
+		f.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeNodeGraph}
+	}
+	return []*data.Frame{nodes, edges}, nil
+}
+
+// resolveNodeGraphOptions fills in the fields the query left empty from the
+// first recognized shape whose source and target appear in the results.
+func resolveNodeGraphOptions(opts humio.NodeGraphOptions, events []map[string]any) humio.NodeGraphOptions {
+	if opts.SourceField == "" && opts.TargetField == "" {
+		for _, shape := range nodeGraphShapes {
+			if !eventsHaveField(events, shape.SourceField) || !eventsHaveField(events, shape.TargetField) {
+				continue
+			}
+			opts.SourceField, opts.TargetField = shape.SourceField, shape.TargetField
+			if opts.TitleField == "" && eventsHaveField(events, shape.TitleField) {
+				opts.TitleField = shape.TitleField
+			}
+			if opts.SubtitleField == "" && eventsHaveField(events, shape.SubtitleField) {
+				opts.SubtitleField = shape.SubtitleField
+			}
+			break
+		}
+	}
+	if opts.MetricField == "" {
+		for _, field := range nodeGraphMetricFields {
+			if eventsHaveField(events, field) {
+				opts.MetricField = field
+				break
+			}
+		}
+	}
+	return opts
+}
+
+// metricField returns the values as numbers when all of them are numeric, or
+// as strings otherwise.
+func metricField(name string, displayName string, values []any) *data.Field {
+	numbers := make([]*float64, len(values))
+	strs := make([]*string, len(values))
+	numeric := true
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		s := fmt.Sprint(v)
+		strs[i] = &s
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			numeric = false
+			continue
+		}
+		numbers[i] = &n
+	}
+	var field *data.Field
+	if numeric {
+		field = data.NewField(name, nil, numbers)
+	} else {
+		field = data.NewField(name, nil, strs)
+	}
+	field.Config = &data.FieldConfig{DisplayName: displayName}
+	return field
+}
+
+func eventString(event map[string]any, field string) string {
+	if field == "" {
+		return ""
+	}
+	v, ok := event[field]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func eventsHaveField(events []map[string]any, field string) bool {
+	if field == "" {
+		return false
+	}
+	for _, event := range events {
+		if _, ok := event[field]; ok {
+			return true
+		}
+	}
+	return false
+}
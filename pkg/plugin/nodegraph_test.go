@@ -0,0 +1,61 @@
+package plugin_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildNodeGraphFrames(t *testing.T) {
+	t.Run("NGSIEM process events become a process tree", func(t *testing.T) {
+		events := []map[string]any{
+			{"ParentProcessId": "1", "TargetProcessId": "2", "ImageFileName": "cmd.exe", "CommandLine": "cmd /c whoami"},
+			{"ParentProcessId": "2", "TargetProcessId": "3", "ImageFileName": "whoami.exe", "CommandLine": "whoami"},
+			{"ParentProcessId": "2", "TargetProcessId": "3", "ImageFileName": "whoami.exe", "CommandLine": "whoami"},
+		}
+
+		frames, err := plugin.BuildNodeGraphFrames(humio.NodeGraphOptions{}, humio.QueryResult{Events: events})
+		require.NoError(t, err)
+		require.Len(t, frames, 2)
+
+		nodes, edges := frames[0], frames[1]
+		require.Equal(t, "nodes", nodes.Name)
+		require.Equal(t, []string{"id", "title", "subtitle"}, fieldNames(nodes))
+		require.Equal(t, 3, nodes.Rows())
+		require.Equal(t, "1", nodes.Fields[1].At(0))
+		require.Equal(t, "cmd.exe", nodes.Fields[1].At(1))
+		require.Equal(t, "whoami", nodes.Fields[2].At(2))
+
+		require.Equal(t, "edges", edges.Name)
+		require.Equal(t, 2, edges.Rows())
+		require.Equal(t, "2", edges.Fields[1].At(1))
+		require.Equal(t, "3", edges.Fields[2].At(1))
+	})
+	t.Run("sankey results use the count as metric", func(t *testing.T) {
+		events := []map[string]any{
+			{"source": "10.0.0.1", "target": "web", "_count": "12"},
+			{"source": "10.0.0.2", "target": "web", "_count": "3"},
+		}
+
+		frames, err := plugin.BuildNodeGraphFrames(humio.NodeGraphOptions{}, humio.QueryResult{Events: events})
+		require.NoError(t, err)
+		edges := frames[1]
+		require.Equal(t, []string{"id", "source", "target", "mainstat"}, fieldNames(edges))
+		metric := edges.Fields[3].At(0).(*float64)
+		require.Equal(t, 12.0, *metric)
+	})
+	t.Run("configured fields are used", func(t *testing.T) {
+		events := []map[string]any{{"src": "a", "dst": "b", "name": "B"}}
+
+		opts := humio.NodeGraphOptions{SourceField: "src", TargetField: "dst", TitleField: "name"}
+		frames, err := plugin.BuildNodeGraphFrames(opts, humio.QueryResult{Events: events})
+		require.NoError(t, err)
+		require.Equal(t, "B", frames[0].Fields[1].At(1))
+	})
+	t.Run("results without source and target are rejected", func(t *testing.T) {
+		_, err := plugin.BuildNodeGraphFrames(humio.NodeGraphOptions{}, humio.QueryResult{Events: []map[string]any{{"host": "a"}}})
+		require.Error(t, err)
+	})
+}
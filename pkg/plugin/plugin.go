@@ -46,6 +46,7 @@ func NewDataSourceInstance(ctx context.Context, settings backend.DataSourceInsta
 		httpadapter.New(resourceHandler),
 		framestruct.ToDataFrame,
 		s,
+		WithIngestClient(client),
 	), nil
 }
 
@@ -61,6 +62,8 @@ func newClient(settings Settings, httpOpts httpclient.Options, streamingOpts htt
 	return humio.NewClient(humio.Config{
 		Address: address,
 		Token:   settings.AccessToken,
+		// live tails are reconnected when they go quiet for too long
+		StreamStallTimeout: settings.streamStallTimeout(),
 		OAuth2Config: humio.OAuth2Config{
 			OAuth2:             settings.OAuth2,
 			OAuth2ClientID:     settings.OAuth2ClientID,
@@ -68,8 +71,3 @@ func newClient(settings Settings, httpOpts httpclient.Options, streamingOpts htt
 		},
 	}, httpOpts, streamingOpts)
 }
-
-func (h *Handler) Dispose() {
-	// Called before creating a new instance to allow plugin authors
-	// to cleanup.
-}
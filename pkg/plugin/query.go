@@ -40,12 +40,14 @@ func (h *Handler) QueryData(ctx context.Context, req *backend.QueryDataRequest)
 
 		var frames []*data.Frame
 		if qr.QueryType == humio.QueryTypeRepositories {
-			repos, err := h.QueryRunner.GetAllRepoNames()
+			domains, err := h.QueryRunner.GetSearchDomains()
 			if err != nil {
-				return nil, err
+				response.Responses[q.RefID] = errorResponse(err)
+				continue
 			}
+			domains = humio.FilterSearchDomains(domains, qr.RepositoryType)
 
-			f, err := h.FrameMarshaller("repositories", humio.ConvertRepos(repos))
+			f, err := h.FrameMarshaller("repositories", humio.ConvertSearchDomains(domains))
 			if err != nil {
 				return nil, err
 			}
@@ -53,31 +55,76 @@ func (h *Handler) QueryData(ctx context.Context, req *backend.QueryDataRequest)
 			frames = append(frames, f)
 		}
 
-		if qr.QueryType == humio.QueryTypeLQL {
-			err = ValidateQuery(qr)
+		if qr.QueryType == humio.QueryTypeRepositoryMetadata {
+			metadata, err := h.QueryRunner.GetRepoMetadata()
+			if err != nil {
+				response.Responses[q.RefID] = errorResponse(err)
+				continue
+			}
+
+			frames = append(frames, RepoMetadataFrame(metadata))
+		}
+
+		if qr.QueryType == humio.QueryTypeSavedSearch {
+			err = ValidateSavedSearchQuery(qr)
 			if err != nil {
 				response.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(err)
 				continue
 			}
 
-			res, err := h.QueryRunner.Run(qr)
+			qr, err = h.QueryRunner.ResolveSavedSearch(qr)
+			if err != nil {
+				response.Responses[q.RefID] = errorResponse(err)
+				continue
+			}
+		}
+
+		qr = expandQuery(qr, q)
+
+		if qr.QueryType == humio.QueryTypeTraceID {
+			qr, err = TraceQuery(qr)
+			if err != nil {
+				response.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(err)
+				continue
+			}
+		}
+
+		if qr.QueryType == humio.QueryTypeLQL || qr.QueryType == humio.QueryTypeSavedSearch || qr.QueryType == humio.QueryTypeTraceID {
+			err = ValidateQuery(qr)
 			if err != nil {
 				response.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(err)
 				continue
 			}
 
+			res, err := h.QueryRunner.Run(qr)
+			if err != nil && len(res) == 0 {
+				response.Responses[q.RefID] = errorResponse(err)
+				continue
+			}
+			// a multi-repository query returns results alongside the errors of the repositories that failed
+			notices := repositoryNotices(err)
+
 			for _, r := range res {
 				if len(r.Events) == 0 {
 					continue
 				}
 
-				f, err := BuildDataFrame(qr.FormatAs, h.FrameMarshaller, r)
+				fs, err := buildFrames(qr, h.FrameMarshaller, r)
 				if err != nil {
 					response.Responses[q.RefID] = backend.ErrorResponseWithErrorSource(err)
 					continue
 				}
 
-				frames = append(frames, f)
+				frames = append(frames, fs...)
+			}
+
+			if len(notices) > 0 {
+				if len(frames) == 0 {
+					frames = append(frames, data.NewFrame("events"))
+				}
+				for _, f := range frames {
+					f.AppendNotices(notices...)
+				}
 			}
 		}
 
@@ -89,16 +136,34 @@ func (h *Handler) QueryData(ctx context.Context, req *backend.QueryDataRequest)
 	return response, nil
 }
 
-func BuildDataFrame(formatAs string, fm FrameMarshallerFunc, r humio.QueryResult) (*data.Frame, error) {
-	// if our query is for template variable options, then we do not want to use the default frame marshaller so everything will be strings
-	if formatAs == humio.FormatVariable {
-		f, err := fm("events", r.Events)
+// buildFrames converts a result into frames for the format of the query.
+// Node graphs, traces and variable options are built from the events
+// directly, everything else through BuildDataFrame.
+func buildFrames(qr humio.Query, fm FrameMarshallerFunc, r humio.QueryResult) ([]*data.Frame, error) {
+	switch qr.FormatAs {
+	case humio.FormatNodeGraph:
+		return BuildNodeGraphFrames(qr.NodeGraph, r)
+	case humio.FormatVariable:
+		f, err := BuildVariableFrame(qr.Variable, fm, r)
+		if err != nil {
+			return nil, err
+		}
+		return []*data.Frame{f}, nil
+	case humio.FormatTrace:
+		f, err := BuildTraceFrame(qr.TraceID, r)
 		if err != nil {
 			return nil, err
 		}
-		return f, nil
+		return []*data.Frame{f}, nil
 	}
+	f, err := BuildDataFrame(qr.FormatAs, fm, r)
+	if err != nil {
+		return nil, err
+	}
+	return []*data.Frame{f}, nil
+}
 
+func BuildDataFrame(formatAs string, fm FrameMarshallerFunc, r humio.QueryResult) (*data.Frame, error) {
 	converters := GetConverters(r.Events)
 	f, err := fm("events", r.Events, converters...)
 	if err != nil {
@@ -106,24 +171,87 @@ func BuildDataFrame(formatAs string, fm FrameMarshallerFunc, r humio.QueryResult
 	}
 
 	OrderFrameFieldsByMetaData(r.Metadata.FieldOrder, f)
-	PrependTimestampField(f)
 
-	if _, ok := r.Events[0]["_bucket"]; ok {
-		f, err = ConvertToWideFormat(f)
+	_, timeBucketed := r.Events[0]["_bucket"]
+	switch formatAs {
+	case humio.FormatTable:
+		// tables keep the field order and shape LogScale returned
+		f.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTable}
+	case humio.FormatTimeSeriesLong:
+		PrependTimestampField(f)
+		prependField(f, "_bucket")
+		f.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesLong, TypeVersion: data.FrameTypeVersion{0, 1}}
+	case humio.FormatHeatmap:
+		PrependTimestampField(f)
+		f, err = ConvertToHeatmap(f)
 		if err != nil {
 			return nil, err
 		}
+	case humio.FormatGeomap:
+		f, err = ConvertToGeo(f)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		PrependTimestampField(f)
+		if timeBucketed {
+			f, err = ConvertToWideFormat(f)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
+	// the custom metadata is left out for plain events, where both are false
+	if meta := (ResultMetadata{IsAggregate: r.Metadata.IsAggregate, IsTimeBucketed: timeBucketed}); meta != (ResultMetadata{}) {
+		if f.Meta == nil {
+			f.Meta = &data.FrameMeta{}
+		}
+		f.Meta.Custom = meta
+	}
 	if formatAs == humio.FormatLogs {
-		f.Meta = &data.FrameMeta{
-			PreferredVisualization: data.VisTypeLogs,
+		if f.Meta == nil {
+			f.Meta = &data.FrameMeta{}
 		}
+		f.Meta.PreferredVisualization = data.VisTypeLogs
+	}
+	if hint := formatHint(formatAs, r.Metadata.IsAggregate, timeBucketed, f); hint != "" {
+		f.AppendNotices(data.Notice{Severity: data.NoticeSeverityInfo, Text: hint})
 	}
 
 	return f, nil
 }
 
+// ResultMetadata is returned in the custom metadata of result frames.
+type ResultMetadata struct {
+	// IsAggregate is reported by LogScale for queries that aggregate events
+	IsAggregate bool `json:"isAggregate"`
+	// IsTimeBucketed is set when the results are bucketed over time, as with timeChart
+	IsTimeBucketed bool `json:"isTimeBucketed"`
+}
+
+// formatHint returns a hint when the frame cannot render as requested, as
+// events without a numeric or time bucketed field formatted as metrics or an
+// aggregate formatted as logs tend to render as an empty looking panel.
+func formatHint(formatAs string, isAggregate, timeBucketed bool, f *data.Frame) string {
+	switch {
+	case formatAs == humio.FormatMetrics && !isAggregate && !timeBucketed && !hasNumericField(f):
+		return "The query returns events rather than aggregated results. Set Format as to Logs to view them in a logs panel."
+	case formatAs == humio.FormatLogs && isAggregate:
+		return "The query returns aggregated results rather than events. Set Format as to Metrics to view them in a graph or table."
+	}
+	return ""
+}
+
+func hasNumericField(f *data.Frame) bool {
+	for _, field := range f.Fields {
+		if field.Type().Numeric() {
+			return true
+		}
+	}
+	return false
+}
+
 func ConvertToWideFormat(frame *data.Frame) (*data.Frame, error) {
 	if frame.TimeSeriesSchema().Type == data.TimeSeriesTypeLong {
 		var err error
@@ -135,31 +263,45 @@ func ConvertToWideFormat(frame *data.Frame) (*data.Frame, error) {
 	return frame, nil
 }
 
+// OrderFrameFieldsByMetaData puts the fields named in fieldOrder first, in
+// that order. Fields that fieldOrder does not list, as the event fields of a
+// select() that are not selected, follow in their original order.
 func OrderFrameFieldsByMetaData(fieldOrder []string, f *data.Frame) {
 	if len(fieldOrder) != 0 {
-		var fields []*data.Field
+		fields := make([]*data.Field, 0, len(f.Fields))
+		ordered := map[*data.Field]bool{}
 		for _, fieldName := range fieldOrder {
 			for _, field := range f.Fields {
-				if field.Name == fieldName {
+				if field.Name == fieldName && !ordered[field] {
 					fields = append(fields, field)
+					ordered[field] = true
 				}
 			}
 		}
+		for _, field := range f.Fields {
+			if !ordered[field] {
+				fields = append(fields, field)
+			}
+		}
 		f.Fields = fields
 	}
 }
 
 func PrependTimestampField(f *data.Frame) {
-	timestampIndex := slices.IndexFunc(f.Fields, func(f *data.Field) bool {
-		if f != nil && f.Name == "@timestamp" {
+	prependField(f, "@timestamp")
+}
+
+func prependField(f *data.Frame, name string) {
+	index := slices.IndexFunc(f.Fields, func(f *data.Field) bool {
+		if f != nil && f.Name == name {
 			return true
 		}
 		return false
 	})
-	if timestampIndex > -1 {
-		timestampField := f.Fields[timestampIndex]
-		removedTimestamp := slices.Delete(f.Fields, timestampIndex, timestampIndex+1)
-		f.Fields = append([]*data.Field{timestampField}, removedTimestamp...)
+	if index > -1 {
+		field := f.Fields[index]
+		removed := slices.Delete(f.Fields, index, index+1)
+		f.Fields = append([]*data.Field{field}, removed...)
 	}
 }
 
@@ -188,8 +330,7 @@ func GetConverters(events Events) []framestruct.FramestructOption {
 		}
 	}
 	for key, v := range fieldNames {
-		// Theses fields are defined by Humio and should be treated as time
-		if key == "@timestamp" || key == "@ingesttimestamp" || key == "@timestamp.nanos" || key == "@collect.timestamp" || key == "_now" || key == "_end" || key == "_start" || key == "_bucket" {
+		if isTimeField(key) {
 			converters = append(converters, framestruct.WithConverterFor(key, ConverterForStringToTime))
 			continue
 		}
@@ -202,6 +343,16 @@ func GetConverters(events Events) []framestruct.FramestructOption {
 	return converters
 }
 
+// isTimeField reports whether the field is one of the fields defined by Humio
+// that should be treated as time.
+func isTimeField(name string) bool {
+	switch name {
+	case "@timestamp", "@ingesttimestamp", "@timestamp.nanos", "@collect.timestamp", "_now", "_end", "_start", "_bucket":
+		return true
+	}
+	return false
+}
+
 func ConverterForStringToTime(input any) (any, error) {
 	var num int64
 	switch v := input.(type) {
@@ -252,9 +403,42 @@ func (h *Handler) queryRequest(q backend.DataQuery) (humio.Query, error) {
 	return gr, nil
 }
 
+// expandQuery expands the macros in the LQL of the query and injects the
+// panel interval as span when AutoSpan is set. It runs after saved searches
+// are resolved, so their query strings are expanded too.
+func expandQuery(gr humio.Query, q backend.DataQuery) humio.Query {
+	gr.LSQL = ExpandMacros(gr, q)
+	if gr.AutoSpan {
+		gr.LSQL = InjectSpan(gr.LSQL, formatDuration(queryInterval(q)))
+	}
+	return gr
+}
+
 func ValidateQuery(q humio.Query) error {
-	if q.Repository == "" {
+	if len(q.Repositories()) == 0 {
 		return backend.DownstreamError(errors.New("select a repository"))
 	}
 	return nil
 }
+
+// ValidateLiveQuery checks a live query, which runs against a single
+// repository.
+func ValidateLiveQuery(q humio.Query) error {
+	if err := ValidateQuery(q); err != nil {
+		return err
+	}
+	if _, err := q.SingleRepository(); err != nil {
+		return backend.DownstreamError(errors.New("live querying supports a single repository, select only one"))
+	}
+	return nil
+}
+
+func ValidateSavedSearchQuery(q humio.Query) error {
+	if err := ValidateQuery(q); err != nil {
+		return err
+	}
+	if q.SavedSearch == "" {
+		return backend.DownstreamError(errors.New("select a saved search"))
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package plugin_test
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
 	"github.com/grafana/grafana-plugin-sdk-go/experimental"
@@ -208,32 +211,217 @@ func TestValidateQuery(t *testing.T) {
 }
 
 func TestFormatQuery(t *testing.T) {
-	t.Run("query uses default frame converters when formatAs is set to variable", func(t *testing.T) {
+	t.Run("query uses custom frame converters when formatAs is set to metrics", func(t *testing.T) {
 		events := []map[string]any{
 			{"numberField": "100", "@timestamp": "2020-01-01T00:00:00Z"},
 			{"numberField": "101", "@timestamp": "2020-01-01T00:01:00Z"},
 		}
 
 		queryResult := humio.QueryResult{Events: events}
-		frame, err := plugin.BuildDataFrame(humio.FormatVariable, framestruct.ToDataFrame, queryResult)
-		//in the frame, numberField should be a string and @timestamp should be string
-		experimental.CheckGoldenJSONFrame(t, "../test_data", "formatAs_set_to_variable", frame, false)
+		frame, err := plugin.BuildDataFrame(humio.FormatMetrics, framestruct.ToDataFrame, queryResult)
+		//in the frame, numberField should be a number and @timestamp should be time
+		experimental.CheckGoldenJSONFrame(t, "../test_data", "formatAs_set_to_metric", frame, false)
 		require.NoError(t, err)
 	})
-	t.Run("query uses custom frame converters when formatAs is set to metrics", func(t *testing.T) {
+	t.Run("aggregate results carry metadata and no hint when formatted as metrics", func(t *testing.T) {
 		events := []map[string]any{
-			{"numberField": "100", "@timestamp": "2020-01-01T00:00:00Z"},
-			{"numberField": "101", "@timestamp": "2020-01-01T00:01:00Z"},
+			{"_bucket": "1577836800000", "_count": "3"},
+			{"_bucket": "1577836860000", "_count": "5"},
+		}
+
+		queryResult := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true}}
+		frame, err := plugin.BuildDataFrame(humio.FormatMetrics, framestruct.ToDataFrame, queryResult)
+		require.NoError(t, err)
+		require.Equal(t, plugin.ResultMetadata{IsAggregate: true, IsTimeBucketed: true}, frame.Meta.Custom)
+		require.Empty(t, frame.Meta.Notices)
+	})
+	t.Run("table format keeps the field order and does not pivot", func(t *testing.T) {
+		events := []map[string]any{
+			{"_bucket": "1577836800000", "host": "a", "_count": "3"},
+			{"_bucket": "1577836800000", "host": "b", "_count": "5"},
+		}
+
+		queryResult := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"host", "_bucket", "_count"}}}
+		frame, err := plugin.BuildDataFrame(humio.FormatTable, framestruct.ToDataFrame, queryResult)
+		require.NoError(t, err)
+		require.Equal(t, 2, frame.Rows())
+		require.Equal(t, []string{"host", "_bucket", "_count"}, fieldNames(frame))
+		require.Equal(t, data.VisType(data.VisTypeTable), frame.Meta.PreferredVisualization)
+	})
+	t.Run("timeseries-long format puts the bucket first and does not pivot", func(t *testing.T) {
+		events := []map[string]any{
+			{"_bucket": "1577836800000", "host": "a", "_count": "3"},
+			{"_bucket": "1577836800000", "host": "b", "_count": "5"},
+		}
+
+		queryResult := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true, FieldOrder: []string{"host", "_bucket", "_count"}}}
+		frame, err := plugin.BuildDataFrame(humio.FormatTimeSeriesLong, framestruct.ToDataFrame, queryResult)
+		require.NoError(t, err)
+		require.Equal(t, 2, frame.Rows())
+		require.Equal(t, []string{"_bucket", "host", "_count"}, fieldNames(frame))
+		require.Equal(t, data.FrameTypeTimeSeriesLong, frame.Meta.Type)
+	})
+	t.Run("events are ordered by the field order and keep the fields missing from it", func(t *testing.T) {
+		events := []map[string]any{
+			{"@rawstring": "a", "host": "a", "user": "b"},
+			{"@rawstring": "b", "host": "b", "user": "c"},
+		}
+
+		queryResult := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{FieldOrder: []string{"user", "@rawstring"}}}
+		frame, err := plugin.BuildDataFrame(humio.FormatTable, framestruct.ToDataFrame, queryResult)
+		require.NoError(t, err)
+		require.Equal(t, []string{"user", "@rawstring", "host"}, fieldNames(frame))
+	})
+	t.Run("events without numeric fields formatted as metrics get a hint", func(t *testing.T) {
+		events := []map[string]any{
+			{"@rawstring": "GET /", "@timestamp": "2020-01-01T00:00:00Z"},
+			{"@rawstring": "GET /api", "@timestamp": "2020-01-01T00:01:00Z"},
 		}
 
 		queryResult := humio.QueryResult{Events: events}
 		frame, err := plugin.BuildDataFrame(humio.FormatMetrics, framestruct.ToDataFrame, queryResult)
-		//in the frame, numberField should be a number and @timestamp should be time
-		experimental.CheckGoldenJSONFrame(t, "../test_data", "formatAs_set_to_metric", frame, false)
 		require.NoError(t, err)
+		require.Len(t, frame.Meta.Notices, 1)
+		require.Contains(t, frame.Meta.Notices[0].Text, "Set Format as to Logs")
+	})
+	t.Run("aggregate results formatted as logs get a hint", func(t *testing.T) {
+		events := []map[string]any{{"host": "a", "_count": "3"}}
+
+		queryResult := humio.QueryResult{Events: events, Metadata: humio.QueryResultMetadata{IsAggregate: true}}
+		frame, err := plugin.BuildDataFrame(humio.FormatLogs, framestruct.ToDataFrame, queryResult)
+		require.NoError(t, err)
+		require.Equal(t, data.VisType(data.VisTypeLogs), frame.Meta.PreferredVisualization)
+		require.Len(t, frame.Meta.Notices, 1)
+		require.Contains(t, frame.Meta.Notices[0].Text, "Set Format as to Metrics")
 	})
 }
 
+func TestQueryData(t *testing.T) {
+	t.Run("API errors carry the LogScale status and error source", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.errs <- backend.DownstreamError(&humio.APIError{StatusCode: http.StatusBadRequest, Detail: "Unknown function"})
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo","lsql":"foo()"}`)}},
+		})
+		require.NoError(t, err)
+		require.ErrorIs(t, res.Responses["A"].Error, humio.ErrBadRequest)
+		require.Equal(t, backend.StatusBadRequest, res.Responses["A"].Status)
+		require.Equal(t, backend.ErrorSourceDownstream, res.Responses["A"].ErrorSource)
+	})
+	t.Run("repositories queries filter by repository type", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.domains = []humio.SearchDomain{
+			{Name: "repo", Type: humio.SearchDomainTypeRepository},
+			{Name: "view", Type: humio.SearchDomainTypeView, Connections: []humio.ViewConnection{{Repository: "repo"}}},
+		}
+
+		_, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"queryType":"Repositories","repositoryType":"view"}`)}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []humio.RepoVariableResponse{
+			{Name: "view", Value: "view", Type: humio.SearchDomainTypeView, Connections: "repo"},
+		}, tc.frameMarshaller.req)
+	})
+	t.Run("repository metadata queries return a table frame", func(t *testing.T) {
+		handler, tc := setup()
+		retention := 30.0
+		size := int64(1024)
+		tc.queryRunner.metadata = []humio.RepositoryMetadata{
+			{Name: "repo", Type: humio.SearchDomainTypeRepository, TimeBasedRetention: &retention, CompressedByteSize: &size},
+			{Name: "view", Type: humio.SearchDomainTypeView},
+		}
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"queryType":"RepositoryMetadata"}`)}},
+		})
+		require.NoError(t, err)
+		require.Len(t, res.Responses["A"].Frames, 1)
+		experimental.CheckGoldenJSONFrame(t, "../test_data", "repository_metadata", res.Responses["A"].Frames[0], true)
+	})
+	t.Run("failed repositories of a multi-repository query become notices", func(t *testing.T) {
+		handler, tc := setup()
+		handler.FrameMarshaller = framestruct.ToDataFrame
+		tc.queryRunner.ret <- humio.QueryResult{Events: []map[string]any{{"field": "value", "repository": "repo1"}}}
+		tc.queryRunner.errs <- &humio.RepositoryError{Repository: "repo2", Err: errors.New("not found")}
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo1,repo2","lsql":""}`)}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+		require.Len(t, res.Responses["A"].Frames, 1)
+		require.Contains(t, res.Responses["A"].Frames[0].Meta.Notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "repo2: not found"})
+	})
+	t.Run("saved search queries run the resolved query string", func(t *testing.T) {
+		handler, tc := setup()
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo","queryType":"SavedSearch","savedSearch":"logins"}`)}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+		require.Equal(t, "saved search for logins", tc.queryRunner.req.LSQL)
+	})
+	t.Run("saved search queries expand macros and inject the span", func(t *testing.T) {
+		handler, tc := setup()
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{
+				RefID:    "A",
+				Interval: time.Minute,
+				JSON:     []byte(`{"repository":"repo","queryType":"SavedSearch","savedSearch":"timechart","autoSpan":true}`),
+			}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+		require.Equal(t, "bucket(span=1m) | timeChart(span=1m)", tc.queryRunner.req.LSQL)
+	})
+	t.Run("saved search queries require a saved search", func(t *testing.T) {
+		handler, _ := setup()
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo","queryType":"SavedSearch"}`)}},
+		})
+		require.NoError(t, err)
+		require.ErrorContains(t, res.Responses["A"].Error, "select a saved search")
+	})
+	t.Run("trace queries search for the trace ID and return a trace frame", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.ret <- humio.QueryResult{Events: []map[string]any{
+			{"traceId": "abc", "spanId": "1", "name": "GET /", "service.name": "web", "startTime": "1577836800000", "duration": "12"},
+		}}
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo","queryType":"TraceID","traceId":"abc","lsql":"#type=otel"}`)}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+		require.Equal(t, `"abc" | #type=otel`, tc.queryRunner.req.LSQL)
+		require.Equal(t, humio.FormatTrace, tc.queryRunner.req.FormatAs)
+		require.Len(t, res.Responses["A"].Frames, 1)
+		require.Equal(t, data.VisType(data.VisTypeTrace), res.Responses["A"].Frames[0].Meta.PreferredVisualization)
+	})
+	t.Run("trace queries require a trace ID", func(t *testing.T) {
+		handler, _ := setup()
+
+		res, err := handler.QueryData(context.Background(), &backend.QueryDataRequest{
+			Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"repository":"repo","queryType":"TraceID"}`)}},
+		})
+		require.NoError(t, err)
+		require.ErrorContains(t, res.Responses["A"].Error, "enter a trace ID")
+	})
+}
+
+func fieldNames(f *data.Frame) []string {
+	names := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
 func newFakeFalconClient() *fakeFalconClient {
 	return &fakeFalconClient{}
 }
@@ -247,6 +435,12 @@ type fakeQueryRunner struct {
 	errs     chan error
 	views    []string
 	viewsErr error
+	metadata []humio.RepositoryMetadata
+	domains  []humio.SearchDomain
+	events   []humio.StreamingResults
+	statuses []humio.StreamStatus
+	live     []humio.QueryResult
+	closed   bool
 	ctx      context.Context
 	cancel   context.CancelFunc
 }
@@ -263,17 +457,64 @@ func (qr *fakeQueryRunner) Run(req humio.Query) ([]humio.QueryResult, error) {
 	}
 }
 
-func (qr *fakeQueryRunner) RunChannel(ctx context.Context, _ humio.Query, c chan humio.StreamingResults) {
+func (qr *fakeQueryRunner) RunChannel(ctx context.Context, _ humio.Query, c chan humio.StreamingResults, status chan<- humio.StreamStatus) {
+	events := qr.events
+	if events == nil {
+		events = []humio.StreamingResults{{"@rawstring": "test", "@timestamp": "1633132800000"}}
+	}
 	go func() {
-		c <- humio.StreamingResults{"@rawstring": "test", "@timestamp": "1633132800000"}
-		qr.cancel()
+		for _, s := range qr.statuses {
+			status <- s
+		}
+		for _, e := range events {
+			c <- e
+		}
+		// give the handler time to take the events from the shared stream
+		time.AfterFunc(20*time.Millisecond, qr.cancel)
+	}()
+}
+
+func (qr *fakeQueryRunner) RunLiveAggregate(ctx context.Context, req humio.Query, c chan<- humio.QueryResult, status chan<- humio.StreamStatus) {
+	qr.req = req
+	go func() {
+		for _, s := range qr.statuses {
+			status <- s
+		}
+		for _, r := range qr.live {
+			c <- r
+		}
+		time.AfterFunc(20*time.Millisecond, qr.cancel)
 	}()
 }
 
+func (qr *fakeQueryRunner) Close(context.Context) error {
+	qr.closed = true
+	return nil
+}
+
 func (qr *fakeQueryRunner) GetAllRepoNames() ([]string, error) {
 	return qr.views, qr.viewsErr
 }
 
+func (qr *fakeQueryRunner) GetSearchDomains() ([]humio.SearchDomain, error) {
+	return qr.domains, qr.viewsErr
+}
+
+func (qr *fakeQueryRunner) GetRepoMetadata() ([]humio.RepositoryMetadata, error) {
+	return qr.metadata, qr.viewsErr
+}
+
+func (qr *fakeQueryRunner) ResolveSavedSearch(req humio.Query) (humio.Query, error) {
+	if req.SavedSearch == "missing" {
+		return req, errors.New("saved search not found")
+	}
+	req.LSQL = "saved search for " + req.SavedSearch
+	if req.SavedSearch == "timechart" {
+		req.LSQL = "bucket(span=$__interval) | timeChart()"
+	}
+	return req, nil
+}
+
 func (qr *fakeQueryRunner) err() error {
 	select {
 	case err := <-qr.errs:
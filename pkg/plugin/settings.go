@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
@@ -18,13 +19,41 @@ type Settings struct {
 	OAuth2ClientID        string   `json:"oauth2ClientId,omitempty"`
 	OAuth2ClientSecret    string   `json:"oauth2ClientSecret,omitempty"`
 	Mode                  string   `json:"mode,omitempty"`
+	// StreamFlushIntervalMs and StreamBatchSize control how often live tail
+	// events are sent as a frame. StreamMaxEventsPerSecond drops events above
+	// the rate when set.
+	StreamFlushIntervalMs    int `json:"streamFlushIntervalMs,omitempty"`
+	StreamBatchSize          int `json:"streamBatchSize,omitempty"`
+	StreamMaxEventsPerSecond int `json:"streamMaxEventsPerSecond,omitempty"`
+	// StreamStallTimeoutSeconds is how long a live tail may go without data
+	// before it is reconnected.
+	StreamStallTimeoutSeconds int `json:"streamStallTimeoutSeconds,omitempty"`
+	// StreamCacheRows, StreamCacheTTLSeconds and StreamCacheMaxBytes bound the
+	// events kept per live tail for new subscribers.
+	StreamCacheRows       int `json:"streamCacheRows,omitempty"`
+	StreamCacheTTLSeconds int `json:"streamCacheTTLSeconds,omitempty"`
+	StreamCacheMaxBytes   int `json:"streamCacheMaxBytes,omitempty"`
+	// IngestEnabled lets Grafana users with at least IngestMinRole write
+	// events to LogScale with IngestToken.
+	IngestEnabled bool   `json:"ingestEnabled,omitempty"`
+	IngestMinRole string `json:"ingestMinRole,omitempty"`
 	//Timeout               uint     `json:"timeout,omitempty"`
 	GraphqlEndpoint string
 	RestEndpoint    string
 	BasicAuthUser   string
 	BasicAuthPass   string
+	IngestToken     string
 }
 
+const (
+	defaultStreamFlushInterval = 500 * time.Millisecond
+	defaultStreamBatchSize     = 500
+	defaultStreamStallTimeout  = 5 * time.Minute
+	defaultStreamCacheRows     = 1000
+	defaultStreamCacheTTL      = 10 * time.Minute
+	defaultStreamCacheMaxBytes = 32 << 20
+)
+
 var (
 	errEmptyURL = errors.New("URL can not be blank")
 )
@@ -58,6 +87,50 @@ func LoadSettings(config backend.DataSourceInstanceSettings) (Settings, error) {
 
 	settings.BasicAuthUser = config.BasicAuthUser
 	settings.BasicAuthPass = secureSettings["basicAuthPassword"]
+	settings.IngestToken = secureSettings["ingestToken"]
 
 	return settings, nil
 }
+
+// streamFlushInterval returns how long live tail events are buffered before
+// they are sent.
+func (s Settings) streamFlushInterval() time.Duration {
+	if s.StreamFlushIntervalMs <= 0 {
+		return defaultStreamFlushInterval
+	}
+	return time.Duration(s.StreamFlushIntervalMs) * time.Millisecond
+}
+
+// streamBatchSize returns the number of buffered live tail events that are
+// sent without waiting for the flush interval.
+func (s Settings) streamBatchSize() int {
+	if s.StreamBatchSize <= 0 {
+		return defaultStreamBatchSize
+	}
+	return s.StreamBatchSize
+}
+
+// streamStallTimeout returns how long a live tail may go without data before
+// it is reconnected.
+func (s Settings) streamStallTimeout() time.Duration {
+	if s.StreamStallTimeoutSeconds <= 0 {
+		return defaultStreamStallTimeout
+	}
+	return time.Duration(s.StreamStallTimeoutSeconds) * time.Second
+}
+
+// newStreamStore returns the store for the last events of each live tail,
+// bounded by the settings.
+func (s Settings) newStreamStore() *streamStore {
+	rows, ttl, maxBytes := s.StreamCacheRows, time.Duration(s.StreamCacheTTLSeconds)*time.Second, s.StreamCacheMaxBytes
+	if rows <= 0 {
+		rows = defaultStreamCacheRows
+	}
+	if ttl <= 0 {
+		ttl = defaultStreamCacheTTL
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultStreamCacheMaxBytes
+	}
+	return newStreamStore(rows, ttl, maxBytes)
+}
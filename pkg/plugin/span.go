@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+)
+
+// spanFunctions are the LogScale functions that bucket events over time.
+var spanFunctions = []string{"timeChart", "bucket"}
+
+// InjectSpan adds span=<span> to every timeChart and bucket call in the query
+// that sets neither span nor buckets. Queries that cannot be parsed are
+// returned unchanged and left for LogScale to report.
+func InjectSpan(lsql string, span string) string {
+	p, err := lql.Parse(lsql)
+	if err != nil {
+		return lsql
+	}
+	for _, fn := range p.Functions() {
+		if !isSpanFunction(fn.Name) || fn.Arg("span") != nil || fn.Arg("buckets") != nil {
+			continue
+		}
+		if err := fn.SetArg("span", span); err != nil {
+			return lsql
+		}
+	}
+	return p.String()
+}
+
+func isSpanFunction(name string) bool {
+	for _, fn := range spanFunctions {
+		if strings.EqualFold(name, fn) {
+			return true
+		}
+	}
+	return false
+}
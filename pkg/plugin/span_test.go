@@ -0,0 +1,31 @@
+package plugin_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		lsql     string
+		expected string
+	}{
+		{name: "bare timeChart", lsql: "timeChart()", expected: "timeChart(span=1m)"},
+		{name: "timeChart with arguments", lsql: "timeChart(host, function=count())", expected: "timeChart(host, function=count(), span=1m)"},
+		{name: "timeChart with a span", lsql: "timeChart(span=5m)", expected: "timeChart(span=5m)"},
+		{name: "bucket with buckets", lsql: "bucket(buckets=10)", expected: "bucket(buckets=10)"},
+		{name: "bucket in a pipeline", lsql: "#type=accesslog | bucket(function=avg(x))", expected: "#type=accesslog | bucket(function=avg(x), span=1m)"},
+		{name: "timeChart in a string", lsql: `msg="timeChart()" | count()`, expected: `msg="timeChart()" | count()`},
+		{name: "timeChart in a comment", lsql: "// timeChart()\ncount()", expected: "// timeChart()\ncount()"},
+		{name: "function with a similar name", lsql: "mytimeChart()", expected: "mytimeChart()"},
+		{name: "unclosed call", lsql: "timeChart(", expected: "timeChart("},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, plugin.InjectSpan(tt.lsql, "1m"))
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type streamFieldKind int
+
+const (
+	streamFieldString streamFieldKind = iota
+	streamFieldNumber
+	streamFieldTime
+)
+
+// streamSchema keeps the fields of a live tail. Every frame carries all fields
+// seen so far, with nulls for the ones an event lacks, so the schema only
+// changes when an event brings a field that has not been seen before or a
+// value that no longer fits the type of its field.
+type streamSchema struct {
+	formatAs string
+	names    []string
+	kinds    map[string]streamFieldKind
+}
+
+func newStreamSchema(formatAs string) *streamSchema {
+	return &streamSchema{formatAs: formatAs, kinds: map[string]streamFieldKind{}}
+}
+
+// Frame converts events into a frame with the schema, first adding the fields
+// of the events it does not know yet. Types are chosen the way GetConverters
+// chooses them for query results.
+func (s *streamSchema) Frame(events []humio.StreamingResults) (*data.Frame, error) {
+	for _, event := range events {
+		if _, ok := event["@timestamp"]; !ok {
+			return nil, fmt.Errorf("no @timestamp field")
+		}
+		for name, v := range event {
+			if v == nil {
+				continue
+			}
+			kind := streamKindOf(name, v)
+			known, ok := s.kinds[name]
+			switch {
+			case !ok:
+				s.names = append(s.names, name)
+				s.kinds[name] = kind
+			case known == streamFieldNumber && kind == streamFieldString:
+				s.kinds[name] = streamFieldString
+			}
+		}
+	}
+	s.sortNames()
+
+	fields := make([]*data.Field, len(s.names))
+	for i, name := range s.names {
+		switch s.kinds[name] {
+		case streamFieldTime:
+			fields[i] = data.NewField(name, nil, make([]*time.Time, len(events)))
+		case streamFieldNumber:
+			fields[i] = data.NewField(name, nil, make([]*float64, len(events)))
+		default:
+			fields[i] = data.NewField(name, nil, make([]*string, len(events)))
+		}
+	}
+	for row, event := range events {
+		for i, name := range s.names {
+			v, ok := event[name]
+			if !ok || v == nil {
+				continue
+			}
+			fields[i].Set(row, s.convert(name, v))
+		}
+	}
+
+	f := data.NewFrame("results", fields...)
+	if s.formatAs == humio.FormatLogs {
+		f.Meta = &data.FrameMeta{
+			PreferredVisualization: data.VisTypeLogs,
+		}
+	}
+	return f, nil
+}
+
+// sortNames puts @timestamp and @rawstring first, followed by the other fields
+// in alphabetical order, so the order does not depend on the order events
+// arrive in.
+func (s *streamSchema) sortNames() {
+	rank := func(name string) int {
+		switch name {
+		case "@timestamp":
+			return 0
+		case "@rawstring":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(s.names, func(i, j int) bool {
+		ri, rj := rank(s.names[i]), rank(s.names[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return s.names[i] < s.names[j]
+	})
+}
+
+// convert returns v as the nullable value of the field's type.
+func (s *streamSchema) convert(name string, v any) any {
+	switch s.kinds[name] {
+	case streamFieldTime:
+		t, err := ConverterForStringToTime(v)
+		if err != nil {
+			return (*time.Time)(nil)
+		}
+		switch t := t.(type) {
+		case *time.Time:
+			return t
+		case time.Time:
+			return &t
+		}
+		return (*time.Time)(nil)
+	case streamFieldNumber:
+		n, err := ConverterForStringToFloat64(fmt.Sprint(v))
+		if err != nil {
+			return (*float64)(nil)
+		}
+		f := n.(float64)
+		return &f
+	}
+	str := fmt.Sprint(v)
+	return &str
+}
+
+func streamKindOf(name string, v any) streamFieldKind {
+	if isTimeField(name) {
+		return streamFieldTime
+	}
+	if _, err := ConverterForStringToFloat64(fmt.Sprint(v)); err == nil {
+		return streamFieldNumber
+	}
+	return streamFieldString
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamSchema(t *testing.T) {
+	t.Run("frames carry all event fields with converted types", func(t *testing.T) {
+		s := newStreamSchema(humio.FormatLogs)
+		f, err := s.Frame([]humio.StreamingResults{
+			{"@timestamp": "1633132800000", "@rawstring": "GET /", "status": "200", "method": "GET"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"@timestamp", "@rawstring", "method", "status"}, frameFieldNames(f))
+		require.Equal(t, data.FieldTypeNullableTime, f.Fields[0].Type())
+		require.Equal(t, time.UnixMilli(1633132800000).UTC(), f.Fields[0].At(0).(*time.Time).UTC())
+		require.Equal(t, data.FieldTypeNullableFloat64, f.Fields[3].Type())
+		require.Equal(t, data.VisType(data.VisTypeLogs), f.Meta.PreferredVisualization)
+	})
+	t.Run("the schema only changes when new fields appear", func(t *testing.T) {
+		s := newStreamSchema(humio.FormatLogs)
+		first, err := s.Frame([]humio.StreamingResults{{"@timestamp": "1", "@rawstring": "a", "host": "x"}})
+		require.NoError(t, err)
+		second, err := s.Frame([]humio.StreamingResults{{"@timestamp": "2", "@rawstring": "b"}})
+		require.NoError(t, err)
+		requireSameSchema(t, first, second, true)
+		require.Nil(t, second.Fields[2].At(0))
+
+		third, err := s.Frame([]humio.StreamingResults{{"@timestamp": "3", "@rawstring": "c", "user": "y"}})
+		require.NoError(t, err)
+		requireSameSchema(t, second, third, false)
+		require.Equal(t, []string{"@timestamp", "@rawstring", "host", "user"}, frameFieldNames(third))
+	})
+	t.Run("numbers become strings when a value is not numeric", func(t *testing.T) {
+		s := newStreamSchema(humio.FormatLogs)
+		_, err := s.Frame([]humio.StreamingResults{{"@timestamp": "1", "code": "1"}})
+		require.NoError(t, err)
+		f, err := s.Frame([]humio.StreamingResults{{"@timestamp": "2", "code": "E1"}})
+		require.NoError(t, err)
+		require.Equal(t, data.FieldTypeNullableString, f.Fields[1].Type())
+	})
+	t.Run("events need a timestamp", func(t *testing.T) {
+		_, err := newStreamSchema(humio.FormatLogs).Frame([]humio.StreamingResults{{"@rawstring": "a"}})
+		require.Error(t, err)
+	})
+}
+
+func frameFieldNames(f *data.Frame) []string {
+	names := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		names[i] = field.Name
+	}
+	return names
+}
+
+func requireSameSchema(t *testing.T, a *data.Frame, b *data.Frame, same bool) {
+	t.Helper()
+	ca, err := data.FrameToJSONCache(a)
+	require.NoError(t, err)
+	cb, err := data.FrameToJSONCache(b)
+	require.NoError(t, err)
+	require.Equal(t, same, ca.SameSchema(&cb))
+}
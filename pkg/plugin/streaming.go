@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
@@ -14,34 +14,59 @@ import (
 )
 
 func (h *Handler) SubscribeStream(ctx context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
-	if !strings.HasPrefix(req.Path, "tail/") {
+	path, err := parseStreamPath(req.Path)
+	if err != nil {
 		return &backend.SubscribeStreamResponse{
 			Status: backend.SubscribeStreamStatusNotFound,
-		}, fmt.Errorf("expected tail in channel path")
+		}, err
 	}
 
 	pluginCfg := backend.PluginConfigFromContext(ctx)
-	namespace := strings.Split(req.Path, "/")[3]
-	if namespace != pluginCfg.Namespace {
+	if path.Namespace != pluginCfg.Namespace {
 		return &backend.SubscribeStreamResponse{
 			Status: backend.SubscribeStreamStatusPermissionDenied,
 		}, fmt.Errorf("invalid namespace supplied in request")
 	}
+	if ds := req.PluginContext.DataSourceInstanceSettings; ds != nil && path.DatasourceUID != ds.UID {
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusPermissionDenied,
+		}, fmt.Errorf("invalid datasource supplied in request")
+	}
 	var qr humio.Query
 	if err := json.Unmarshal(req.Data, &qr); err != nil {
-		return nil, err
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusNotFound,
+		}, err
+	}
+	// the channel must be the one of the query, so a channel cannot be
+	// joined with a different query
+	if path.QueryHash != streamQueryHash(qr) {
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusPermissionDenied,
+		}, fmt.Errorf("query does not match the channel path")
 	}
 
-	err := ValidateQuery(qr)
-	if err != nil {
+	if err := ValidateLiveQuery(qr); err != nil {
 		return nil, err
 	}
 
-	h.streamsMu.RLock()
-	defer h.streamsMu.RUnlock()
+	// live aggregates send their whole result on every refresh
+	if qr.LiveMode == humio.LiveModeAggregate {
+		return &backend.SubscribeStreamResponse{
+			Status: backend.SubscribeStreamStatusOK,
+		}, nil
+	}
 
-	cache, ok := h.Streams[req.Path]
-	if ok {
+	// streams of the same query share their upstream and so their cache
+	f, err := h.Streams.Frame(newStreamKey(qr, h.Settings, req.PluginContext.User).String(), qr.FormatAs)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		cache, err := data.FrameToJSONCache(f)
+		if err != nil {
+			return nil, err
+		}
 		msg, err := backend.NewInitialData(cache.Bytes(data.IncludeAll))
 		return &backend.SubscribeStreamResponse{
 			Status:      backend.SubscribeStreamStatusOK,
@@ -54,91 +79,254 @@ func (h *Handler) SubscribeStream(ctx context.Context, req *backend.SubscribeStr
 	}, nil
 }
 
-func (h *Handler) PublishStream(context.Context, *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+// PublishStream queues the events published to the ingest channel to be
+// written to LogScale. Publishing is denied unless ingest is enabled and the
+// user has the role it requires.
+func (h *Handler) PublishStream(_ context.Context, req *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	if req.Path != ingestChannelPath {
+		return &backend.PublishStreamResponse{
+			Status: backend.PublishStreamStatusNotFound,
+		}, nil
+	}
+	if err := h.Settings.checkIngest(req.PluginContext.User); err != nil || h.ingest == nil {
+		return &backend.PublishStreamResponse{
+			Status: backend.PublishStreamStatusPermissionDenied,
+		}, nil
+	}
+	batch, err := decodeIngestBatch(req.Data, req.PluginContext.User)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+	h.ingest.Add(batch)
 	return &backend.PublishStreamResponse{
-		Status: backend.PublishStreamStatusPermissionDenied,
+		Status: backend.PublishStreamStatusOK,
 	}, nil
 }
 
 func (h *Handler) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	ctx, stop, ok := h.trackStream(ctx)
+	defer stop()
+	if !ok {
+		return ctx.Err()
+	}
+
 	var qr humio.Query
 	if err := json.Unmarshal(req.Data, &qr); err != nil {
 		return err
 	}
-	err := ValidateQuery(qr)
+	err := ValidateLiveQuery(qr)
 	if err != nil {
 		return err
 	}
 
-	c := make(chan humio.StreamingResults)
-	defer close(c)
+	if qr.LiveMode == humio.LiveModeAggregate {
+		return h.runLiveAggregate(ctx, qr, sender)
+	}
+
+	key := newStreamKey(qr, h.Settings, req.PluginContext.User)
 	prev := data.FrameJSONCache{}
+	schema := newStreamSchema(qr.FormatAs)
+	limiter := newStreamRateLimiter(h.Settings.StreamMaxEventsPerSecond)
+	batchSize := h.Settings.streamBatchSize()
+	var batch []humio.StreamingResults
+
+	flush := func(notices ...data.Notice) {
+		if len(batch) == 0 && len(notices) == 0 {
+			return
+		}
+		dropped := limiter.TakeDropped()
+		f, err := schema.Frame(batch)
+		batch = batch[:0]
+		if err != nil {
+			log.DefaultLogger.Error("Failed to convert streaming results to frames", "err", err)
+			return
+		}
+		f.AppendNotices(notices...)
+		if dropped > 0 {
+			f.AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("Dropped %d events: live tail is limited to %d events per second", dropped, limiter.maxRate),
+			})
+		}
+		next, err := data.FrameToJSONCache(f)
+		if err != nil {
+			log.DefaultLogger.Error("Failed to get next frame cache", err)
+			return
+		}
+		if next.SameSchema(&prev) {
+			err = sender.SendFrame(f, data.IncludeDataOnly)
+		} else {
+			err = sender.SendFrame(f, data.IncludeAll)
+		}
+		if err != nil {
+			log.DefaultLogger.Error("Websocket write:", "err", err)
+			return
+		}
+		prev = next
+	}
+
+	ticker := time.NewTicker(h.Settings.streamFlushInterval())
+	defer ticker.Stop()
+
+	sub, unsubscribe := h.streamMux.Subscribe(key, qr, h.QueryRunner)
+	defer unsubscribe()
+
+	add := func(r humio.StreamingResults) {
+		if _, ok := r["@timestamp"]; !ok {
+			log.DefaultLogger.Error("Failed to convert streaming results to frames", "err", "no @timestamp field", "data", r)
+			return
+		}
+		if limiter.Allow(time.Now()) {
+			batch = append(batch, r)
+		}
+	}
 
-	h.QueryRunner.RunChannel(ctx, qr, c)
+	drain := func() {
+		for {
+			select {
+			case r := <-sub.Events:
+				add(r)
+			default:
+				return
+			}
+		}
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			// send what was received before the stream stopped
+			drain()
+			flush()
 			log.DefaultLogger.Info("Context done, exiting stream", "reason", ctx.Err())
 			return ctx.Err()
-		case r := <-c:
-			f, err := convertResultsToFrame(qr.FormatAs, r)
-			if err != nil {
-				log.DefaultLogger.Error("Failed to convert streaming results to frames", "err", err, "data", r)
-				continue
+		case <-ticker.C:
+			flush()
+		case s := <-sub.Status:
+			flush(streamStatusNotice(s))
+		case <-sub.Closed:
+			// the upstream failed or this stream fell behind
+			drain()
+			flush(streamStatusNotice(humio.StreamStatus{State: humio.StreamStateFailed, Err: sub.Err}))
+			return sub.Err
+		case r := <-sub.Events:
+			add(r)
+			if len(batch) >= batchSize {
+				flush()
 			}
-			if f != nil && len(f.Fields) > 0 {
-				next, err := data.FrameToJSONCache(f)
-				if err != nil {
-					log.DefaultLogger.Error("Failed to get next frame cache", err)
-					continue
-				}
-				if next.SameSchema(&prev) {
-					err = sender.SendFrame(f, data.IncludeDataOnly)
-				} else {
-					err = sender.SendFrame(f, data.IncludeAll)
+		}
+	}
+}
+
+// runLiveAggregate streams the refreshed results of a live query job. Every
+// result is complete, the frontend subscribes with the replace buffer action so
+// Grafana replaces the previous result instead of appending to it.
+func (h *Handler) runLiveAggregate(ctx context.Context, qr humio.Query, sender *backend.StreamSender) error {
+	results := make(chan humio.QueryResult)
+	status := make(chan humio.StreamStatus)
+	h.QueryRunner.RunLiveAggregate(ctx, qr, results, status)
+
+	var last []*data.Frame
+	send := func(frames []*data.Frame) {
+		for _, f := range frames {
+			if err := sender.SendFrame(f, data.IncludeAll); err != nil {
+				log.DefaultLogger.Error("Websocket write:", "err", err)
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.DefaultLogger.Info("Context done, exiting stream", "reason", ctx.Err())
+			return ctx.Err()
+		case s := <-status:
+			if len(last) == 0 {
+				last = []*data.Frame{data.NewFrame("events")}
+			}
+			// resend the last result so the notice does not clear the panel
+			frames := make([]*data.Frame, len(last))
+			for i, f := range last {
+				c := *f
+				c.Meta = nil
+				if f.Meta != nil {
+					meta := *f.Meta
+					meta.Notices = slices.Clone(meta.Notices)
+					c.Meta = &meta
 				}
+				c.AppendNotices(streamStatusNotice(s))
+				frames[i] = &c
+			}
+			send(frames)
+		case r := <-results:
+			frames := []*data.Frame{data.NewFrame("events")}
+			if len(r.Events) > 0 {
+				var err error
+				frames, err = buildFrames(qr, h.FrameMarshaller, r)
 				if err != nil {
-					log.DefaultLogger.Error("Websocket write:", "err", err)
+					log.DefaultLogger.Error("Failed to convert live aggregate results to frames", "err", err)
 					continue
 				}
-				prev = next
-
-				// Cache the initial data
-				h.streamsMu.Lock()
-				h.Streams[req.Path] = prev
-				h.streamsMu.Unlock()
 			}
+			last = frames
+			send(frames)
 		}
 	}
 }
 
-func convertResultsToFrame(formatAs string, results humio.StreamingResults) (*data.Frame, error) {
-	f := data.NewFrame(
-		"results",
-		data.NewField("@timestamp", nil, []*time.Time{}),
-		data.NewField("@rawstring", nil, []string{}),
-	)
-	if formatAs == humio.FormatLogs {
-		f.Meta = &data.FrameMeta{
-			PreferredVisualization: data.VisTypeLogs,
+// streamStatusNotice describes a change in the connection of a live tail to
+// the user.
+func streamStatusNotice(s humio.StreamStatus) data.Notice {
+	switch s.State {
+	case humio.StreamStateReconnecting:
+		return data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Live tail disconnected, reconnecting (attempt %d): %v", s.Attempt, s.Err),
+		}
+	case humio.StreamStateFailed:
+		return data.Notice{
+			Severity: data.NoticeSeverityError,
+			Text:     fmt.Sprintf("Live tail stopped: %v", s.Err),
 		}
 	}
-	timestampString, ok := results["@timestamp"]
-	if !ok {
-		return nil, fmt.Errorf("no @timestamp field")
+	return data.Notice{Severity: data.NoticeSeverityInfo, Text: "Live tail reconnected"}
+}
+
+// streamRateLimiter counts live tail events per second and drops the ones above
+// maxRate. A maxRate of zero lets every event through.
+type streamRateLimiter struct {
+	maxRate int
+	window  time.Time
+	count   int
+	dropped int
+}
+
+func newStreamRateLimiter(maxRate int) *streamRateLimiter {
+	return &streamRateLimiter{maxRate: maxRate}
+}
+
+// Allow reports whether an event arriving at now is within the rate, counting
+// it as dropped otherwise.
+func (l *streamRateLimiter) Allow(now time.Time) bool {
+	if l.maxRate <= 0 {
+		return true
 	}
-	timestamp, err := ConverterForStringToTime(timestampString)
-	if err != nil {
-		return nil, err
+	if now.Sub(l.window) >= time.Second {
+		l.window = now
+		l.count = 0
 	}
-	rawstring, ok := results["@rawstring"]
-	if !ok {
-		return nil, fmt.Errorf("no @rawstring field")
+	if l.count >= l.maxRate {
+		l.dropped++
+		return false
 	}
-	f.AppendRow(
-		timestamp,
-		rawstring,
-	)
-	return f, err
+	l.count++
+	return true
+}
+
+// TakeDropped returns the number of events dropped since the last call.
+func (l *streamRateLimiter) TakeDropped() int {
+	dropped := l.dropped
+	l.dropped = 0
+	return dropped
 }
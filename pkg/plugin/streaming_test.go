@@ -3,8 +3,13 @@ package plugin_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
@@ -43,7 +48,7 @@ func TestSubscribeStream(t *testing.T) {
 			Namespace: "stacks-1",
 		})
 		req := &backend.SubscribeStreamRequest{
-			Path: "tail/dsId/test-path/stacks-1",
+			Path: plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "test-repository"}),
 			Data: json.RawMessage(`{"repository":"test-repository"}`),
 		}
 		resp, err := handler.SubscribeStream(ctx, req)
@@ -52,6 +57,34 @@ func TestSubscribeStream(t *testing.T) {
 		require.Equal(t, backend.SubscribeStreamStatusOK, resp.Status)
 	})
 
+	t.Run("sends the last events of the stream as initial data", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.events = []humio.StreamingResults{
+			{"@rawstring": "a", "@timestamp": "1633132800000"},
+			{"@rawstring": "b", "@timestamp": "1633132800001"},
+		}
+		query := json.RawMessage(`{"repository":"test-repository"}`)
+		err := handler.RunStream(tc.queryRunner.ctx, &backend.RunStreamRequest{Data: query}, backend.NewStreamSender(&mockStreamPacketSender{}))
+		require.ErrorIs(t, err, context.Canceled)
+
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{Namespace: "stacks-1"})
+		resp, err := handler.SubscribeStream(ctx, &backend.SubscribeStreamRequest{
+			Path: plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "test-repository"}),
+			Data: query,
+		})
+		require.NoError(t, err)
+		require.Equal(t, backend.SubscribeStreamStatusOK, resp.Status)
+		require.NotNil(t, resp.InitialData)
+
+		var frame struct {
+			Data struct {
+				Values [][]any `json:"values"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(resp.InitialData.Data(), &frame))
+		require.Equal(t, []any{"a", "b"}, frame.Data.Values[1])
+	})
+
 	t.Run("subscribe fails if namespace in path does not match plugin request", func(t *testing.T) {
 		handler, _ := setup()
 		ctx := context.Background()
@@ -59,7 +92,7 @@ func TestSubscribeStream(t *testing.T) {
 			Namespace: "stacks-1",
 		})
 		req := &backend.SubscribeStreamRequest{
-			Path: "tail/dsId/test-path/stacks-2",
+			Path: plugin.StreamChannelPath("stacks-2", "dsId", humio.Query{Repository: "test-repository"}),
 			Data: json.RawMessage(`{"repository":"test-repository"}`),
 		}
 		resp, err := handler.SubscribeStream(ctx, req)
@@ -67,6 +100,139 @@ func TestSubscribeStream(t *testing.T) {
 		require.Error(t, err)
 		require.Equal(t, backend.SubscribeStreamStatusPermissionDenied, resp.Status)
 	})
+
+	t.Run("subscribe fails on short paths", func(t *testing.T) {
+		handler, _ := setup()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{Namespace: "stacks-1"})
+		for _, path := range []string{"", "tail", "tail/", "tail/v1", "tail/v1/stacks-1/dsId"} {
+			resp, err := handler.SubscribeStream(ctx, &backend.SubscribeStreamRequest{Path: path})
+
+			require.Error(t, err, path)
+			require.Equal(t, backend.SubscribeStreamStatusNotFound, resp.Status, path)
+		}
+	})
+
+	t.Run("subscribe fails for another datasource", func(t *testing.T) {
+		handler, _ := setup()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{Namespace: "stacks-1"})
+		req := &backend.SubscribeStreamRequest{
+			PluginContext: backend.PluginContext{DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "dsId"}},
+			Path:          plugin.StreamChannelPath("stacks-1", "otherId", humio.Query{Repository: "test-repository"}),
+			Data:          json.RawMessage(`{"repository":"test-repository"}`),
+		}
+		resp, err := handler.SubscribeStream(ctx, req)
+
+		require.Error(t, err)
+		require.Equal(t, backend.SubscribeStreamStatusPermissionDenied, resp.Status)
+	})
+
+	t.Run("subscribe fails if the query does not match the path", func(t *testing.T) {
+		handler, _ := setup()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{Namespace: "stacks-1"})
+		req := &backend.SubscribeStreamRequest{
+			Path: plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "test-repository"}),
+			Data: json.RawMessage(`{"repository":"other-repository"}`),
+		}
+		resp, err := handler.SubscribeStream(ctx, req)
+
+		require.Error(t, err)
+		require.Equal(t, backend.SubscribeStreamStatusPermissionDenied, resp.Status)
+	})
+
+	t.Run("subscribe fails for several repositories", func(t *testing.T) {
+		handler, _ := setup()
+		ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{Namespace: "stacks-1"})
+		req := &backend.SubscribeStreamRequest{
+			Path: plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "repo1,repo2"}),
+			Data: json.RawMessage(`{"repository":"repo1,repo2"}`),
+		}
+		_, err := handler.SubscribeStream(ctx, req)
+
+		require.ErrorContains(t, err, "single repository")
+		require.True(t, backend.IsDownstreamError(err))
+	})
+
+	t.Run("panels with the same query share a path", func(t *testing.T) {
+		a := plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "repo", LSQL: "error "})
+		b := plugin.StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: " repo", LSQL: "error", LiveMode: humio.LiveModeTail})
+		require.Equal(t, a, b)
+		require.Regexp(t, `^tail/v1/stacks-1/dsId/[0-9a-f]{32}$`, a)
+	})
+}
+
+func TestPublishStream(t *testing.T) {
+	editor := backend.PluginContext{User: &backend.User{Login: "editor", Role: "Editor"}}
+	events := json.RawMessage(`{"events":[{"rawstring":"acknowledged by editor"}]}`)
+
+	t.Run("denies publishing when ingest is disabled", func(t *testing.T) {
+		handler, _ := setup()
+		resp, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: editor, Path: "ingest", Data: events})
+
+		require.NoError(t, err)
+		require.Equal(t, backend.PublishStreamStatusPermissionDenied, resp.Status)
+	})
+
+	t.Run("denies publishing below the minimum role", func(t *testing.T) {
+		handler, _ := setupIngest()
+		viewer := backend.PluginContext{User: &backend.User{Login: "viewer", Role: "Viewer"}}
+		resp, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: viewer, Path: "ingest", Data: events})
+
+		require.NoError(t, err)
+		require.Equal(t, backend.PublishStreamStatusPermissionDenied, resp.Status)
+	})
+
+	t.Run("returns not found for other channels", func(t *testing.T) {
+		handler, _ := setupIngest()
+		resp, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: editor, Path: "tail", Data: events})
+
+		require.NoError(t, err)
+		require.Equal(t, backend.PublishStreamStatusNotFound, resp.Status)
+	})
+
+	t.Run("queues published events for ingest", func(t *testing.T) {
+		handler, client := setupIngest()
+		resp, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: editor, Path: "ingest", Data: events})
+		require.NoError(t, err)
+		require.Equal(t, backend.PublishStreamStatusOK, resp.Status)
+
+		require.Eventually(t, func() bool { return len(client.Batches()) == 1 }, 5*time.Second, 50*time.Millisecond)
+		batch := client.Batches()[0]
+		require.Equal(t, "acknowledged by editor", batch.Events[0].RawString)
+		require.Equal(t, "editor", batch.Events[0].Attributes["grafanaUser"])
+	})
+
+	t.Run("rejects invalid payloads", func(t *testing.T) {
+		handler, _ := setupIngest()
+		_, err := handler.PublishStream(context.Background(), &backend.PublishStreamRequest{PluginContext: editor, Path: "ingest", Data: json.RawMessage(`{"events":[]}`)})
+
+		require.Error(t, err)
+	})
+}
+
+func setupIngest() (*plugin.Handler, *fakeIngestClient) {
+	client := &fakeIngestClient{}
+	handler, _ := setup()
+	handler = plugin.NewHandler(handler.Client, handler.QueryRunner, handler.ResourceHandler, handler.FrameMarshaller,
+		plugin.Settings{IngestEnabled: true, IngestToken: "ingest-token"}, plugin.WithIngestClient(client))
+	return handler, client
+}
+
+type fakeIngestClient struct {
+	mu      sync.Mutex
+	batches []humio.IngestBatch
+}
+
+func (c *fakeIngestClient) Ingest(_ context.Context, _ string, batches []humio.IngestBatch) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches = append(c.batches, batches...)
+	return nil
+}
+
+func (c *fakeIngestClient) Batches() []humio.IngestBatch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.batches
 }
 
 func TestRunStream(t *testing.T) {
@@ -97,4 +263,98 @@ func TestRunStream(t *testing.T) {
 		require.ErrorIs(t, err, context.Canceled)
 		require.True(t, sentCount == 1)
 	})
+	t.Run("batches events into multi-row frames", func(t *testing.T) {
+		handler, tc := setup()
+		handler.Settings.StreamBatchSize = 2
+		handler.Settings.StreamFlushIntervalMs = 60000
+		tc.queryRunner.events = []humio.StreamingResults{
+			{"@rawstring": "a", "@timestamp": "1633132800000"},
+			{"@rawstring": "b", "@timestamp": "1633132800001"},
+			{"@rawstring": "c", "@timestamp": "1633132800002"},
+		}
+
+		var rows []int
+		sender := backend.NewStreamSender(&mockStreamPacketSender{
+			sendFunc: func(packet *backend.StreamPacket) error {
+				var frame struct {
+					Data struct {
+						Values [][]any `json:"values"`
+					} `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(packet.Data, &frame))
+				rows = append(rows, len(frame.Data.Values[0]))
+				return nil
+			},
+		})
+
+		err := handler.RunStream(tc.queryRunner.ctx, &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test"}`)}, sender)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, []int{2, 1}, rows)
+	})
+	t.Run("drops events above the max rate with a notice", func(t *testing.T) {
+		handler, tc := setup()
+		handler.Settings.StreamMaxEventsPerSecond = 1
+		handler.Settings.StreamFlushIntervalMs = 60000
+		tc.queryRunner.events = []humio.StreamingResults{
+			{"@rawstring": "a", "@timestamp": "1633132800000"},
+			{"@rawstring": "b", "@timestamp": "1633132800001"},
+			{"@rawstring": "c", "@timestamp": "1633132800002"},
+		}
+
+		var packets []string
+		sender := backend.NewStreamSender(&mockStreamPacketSender{
+			sendFunc: func(packet *backend.StreamPacket) error {
+				packets = append(packets, string(packet.Data))
+				return nil
+			},
+		})
+
+		err := handler.RunStream(tc.queryRunner.ctx, &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test"}`)}, sender)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Len(t, packets, 1)
+		require.Contains(t, packets[0], "Dropped 2 events")
+	})
+	t.Run("streams the refreshed results of live aggregates", func(t *testing.T) {
+		handler, tc := setup()
+		handler.FrameMarshaller = framestruct.ToDataFrame
+		tc.queryRunner.live = []humio.QueryResult{
+			{Events: []map[string]any{{"service": "api", "_count": "1"}}, Metadata: humio.QueryResultMetadata{IsAggregate: true}},
+			{Events: []map[string]any{{"service": "api", "_count": "2"}}, Metadata: humio.QueryResultMetadata{IsAggregate: true}},
+		}
+
+		var packets []string
+		sender := backend.NewStreamSender(&mockStreamPacketSender{
+			sendFunc: func(packet *backend.StreamPacket) error {
+				packets = append(packets, string(packet.Data))
+				return nil
+			},
+		})
+
+		req := &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test","lsql":"groupBy(service)","liveMode":"aggregate","formatAs":"table"}`)}
+		err := handler.RunStream(tc.queryRunner.ctx, req, sender)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, "groupBy(service)", tc.queryRunner.req.LSQL)
+		require.Len(t, packets, 2)
+		for i, count := range []string{`[[1],`, `[[2],`} {
+			require.Contains(t, packets[i], `"schema"`)
+			require.Contains(t, packets[i], count)
+		}
+	})
+	t.Run("reports reconnects as notices", func(t *testing.T) {
+		handler, tc := setup()
+		tc.queryRunner.statuses = []humio.StreamStatus{{State: humio.StreamStateReconnecting, Attempt: 1, Err: errors.New("connection reset")}}
+
+		var packets []string
+		sender := backend.NewStreamSender(&mockStreamPacketSender{
+			sendFunc: func(packet *backend.StreamPacket) error {
+				packets = append(packets, string(packet.Data))
+				return nil
+			},
+		})
+
+		err := handler.RunStream(tc.queryRunner.ctx, &backend.RunStreamRequest{Data: json.RawMessage(`{"repository":"test"}`)}, sender)
+		require.ErrorIs(t, err, context.Canceled)
+		require.NotEmpty(t, packets)
+		require.Contains(t, packets[0], "Live tail disconnected, reconnecting (attempt 1): connection reset")
+	})
 }
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+)
+
+// Live channel paths have the form
+//
+//	tail/v1/<namespace>/<datasource uid>/<query hash>
+//
+// where the query hash identifies the normalized query, so the same query from
+// different panels subscribes to the same channel.
+const (
+	streamPathPrefix  = "tail"
+	streamPathVersion = "v1"
+	// streamQueryHashLen is the number of hex characters of the query hash
+	streamQueryHashLen = 32
+)
+
+var errInvalidStreamPath = errors.New("invalid live channel path")
+
+// streamPath is a parsed live channel path.
+type streamPath struct {
+	Namespace     string
+	DatasourceUID string
+	QueryHash     string
+}
+
+// StreamChannelPath returns the live channel path of a query. The frontend
+// builds the same path in getLiveStreamPath.
+func StreamChannelPath(namespace, datasourceUID string, qr humio.Query) string {
+	return streamPath{Namespace: namespace, DatasourceUID: datasourceUID, QueryHash: streamQueryHash(qr)}.String()
+}
+
+func (p streamPath) String() string {
+	return strings.Join([]string{streamPathPrefix, streamPathVersion, p.Namespace, p.DatasourceUID, p.QueryHash}, "/")
+}
+
+// parseStreamPath parses a live channel path, returning errInvalidStreamPath
+// when it does not have the form above.
+func parseStreamPath(path string) (streamPath, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 5 || parts[0] != streamPathPrefix || parts[1] != streamPathVersion {
+		return streamPath{}, errInvalidStreamPath
+	}
+	p := streamPath{Namespace: parts[2], DatasourceUID: parts[3], QueryHash: parts[4]}
+	if p.Namespace == "" || p.DatasourceUID == "" || !isQueryHash(p.QueryHash) {
+		return streamPath{}, errInvalidStreamPath
+	}
+	return p, nil
+}
+
+// streamQueryHash hashes the parts of a query that change what a live stream
+// sends. Repository and query are trimmed and the live mode defaults to tail.
+func streamQueryHash(qr humio.Query) string {
+	liveMode := qr.LiveMode
+	if liveMode == "" {
+		liveMode = humio.LiveModeTail
+	}
+	normalized := strings.Join([]string{
+		strings.TrimSpace(qr.Repository),
+		strings.TrimSpace(qr.LSQL),
+		qr.FormatAs,
+		liveMode,
+		qr.Start,
+	}, "\x00")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:streamQueryHashLen]
+}
+
+func isQueryHash(s string) bool {
+	if len(s) != streamQueryHashLen {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
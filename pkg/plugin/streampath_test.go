@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreamPath(t *testing.T) {
+	hash := streamQueryHash(humio.Query{Repository: "repo"})
+
+	p, err := parseStreamPath("tail/v1/stacks-1/dsId/" + hash)
+	require.NoError(t, err)
+	require.Equal(t, streamPath{Namespace: "stacks-1", DatasourceUID: "dsId", QueryHash: hash}, p)
+
+	for _, path := range []string{
+		"",
+		"tail",
+		"tail/dsId/test-path/stacks-1",
+		"tail/v2/stacks-1/dsId/" + hash,
+		"tail/v1//dsId/" + hash,
+		"tail/v1/stacks-1//" + hash,
+		"tail/v1/stacks-1/dsId/" + hash[:10],
+		"tail/v1/stacks-1/dsId/" + hash + "/extra",
+		"tail/v1/stacks-1/dsId/ABCDEF0123456789ABCDEF0123456789",
+	} {
+		_, err := parseStreamPath(path)
+		require.ErrorIs(t, err, errInvalidStreamPath, path)
+	}
+}
+
+func FuzzParseStreamPath(f *testing.F) {
+	f.Add("")
+	f.Add("tail/")
+	f.Add("tail/dsId/test-path/stacks-1")
+	f.Add(StreamChannelPath("stacks-1", "dsId", humio.Query{Repository: "repo", LSQL: "error"}))
+	f.Fuzz(func(t *testing.T, path string) {
+		p, err := parseStreamPath(path)
+		if err != nil {
+			return
+		}
+		require.Equal(t, path, p.String())
+		again, err := parseStreamPath(p.String())
+		require.NoError(t, err)
+		require.Equal(t, p, again)
+	})
+}
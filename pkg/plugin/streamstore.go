@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// eventOverhead is added to the size of every cached event for the map and
+// interface headers that are not part of its keys and values.
+const eventOverhead = 64
+
+// streamStore keeps the last events of each stream so new subscribers get
+// them as initial data. Each stream keeps at most maxRows events, streams
+// that are neither written nor read for ttl are evicted, and the least
+// recently used streams are dropped while all events together are estimated
+// to take more than maxBytes.
+type streamStore struct {
+	mu       sync.Mutex
+	maxRows  int
+	ttl      time.Duration
+	maxBytes int
+	bytes    int
+	entries  map[string]*streamEntry
+	now      func() time.Time
+}
+
+type streamEntry struct {
+	// rows is a ring buffer of events starting at head
+	rows     []humio.StreamingResults
+	sizes    []int
+	head     int
+	bytes    int
+	lastUsed time.Time
+}
+
+func newStreamStore(maxRows int, ttl time.Duration, maxBytes int) *streamStore {
+	return &streamStore{
+		maxRows:  maxRows,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		entries:  map[string]*streamEntry{},
+		now:      time.Now,
+	}
+}
+
+// Append adds events to the stream, dropping its oldest events once it holds
+// maxRows.
+func (s *streamStore) Append(key string, events ...humio.StreamingResults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictIdle(now)
+	e, ok := s.entries[key]
+	if !ok {
+		e = &streamEntry{}
+		s.entries[key] = e
+	}
+	e.lastUsed = now
+	for _, event := range events {
+		size := eventSize(event)
+		if len(e.rows) < s.maxRows {
+			e.rows = append(e.rows, event)
+			e.sizes = append(e.sizes, size)
+		} else {
+			s.bytes -= e.sizes[e.head]
+			e.bytes -= e.sizes[e.head]
+			e.rows[e.head] = event
+			e.sizes[e.head] = size
+			e.head = (e.head + 1) % len(e.rows)
+		}
+		e.bytes += size
+		s.bytes += size
+	}
+	s.enforceMaxBytes(key)
+}
+
+// Events returns the cached events of the stream, oldest first.
+func (s *streamStore) Events(key string) []humio.StreamingResults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictIdle(now)
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	e.lastUsed = now
+	events := make([]humio.StreamingResults, 0, len(e.rows))
+	events = append(events, e.rows[e.head:]...)
+	return append(events, e.rows[:e.head]...)
+}
+
+// Frame returns the cached events of the stream as a frame, or nil when none
+// are cached.
+func (s *streamStore) Frame(key string, formatAs string) (*data.Frame, error) {
+	events := s.Events(key)
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return newStreamSchema(formatAs).Frame(events)
+}
+
+// Len returns the number of streams with cached events.
+func (s *streamStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *streamStore) evictIdle(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for key, e := range s.entries {
+		if now.Sub(e.lastUsed) >= s.ttl {
+			s.remove(key)
+		}
+	}
+}
+
+// enforceMaxBytes drops the least recently used streams other than keep until
+// the store fits, and then the oldest events of keep.
+func (s *streamStore) enforceMaxBytes(keep string) {
+	if s.maxBytes <= 0 {
+		return
+	}
+	for s.bytes > s.maxBytes {
+		oldest := ""
+		for key, e := range s.entries {
+			if key == keep {
+				continue
+			}
+			if oldest == "" || e.lastUsed.Before(s.entries[oldest].lastUsed) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			break
+		}
+		s.remove(oldest)
+	}
+	e, ok := s.entries[keep]
+	if !ok {
+		return
+	}
+	for s.bytes > s.maxBytes && len(e.rows) > 0 {
+		s.bytes -= e.sizes[e.head]
+		e.bytes -= e.sizes[e.head]
+		// unroll the ring so the oldest event is first, then drop it
+		e.rows = append(e.rows[e.head:], e.rows[:e.head]...)[1:]
+		e.sizes = append(e.sizes[e.head:], e.sizes[:e.head]...)[1:]
+		e.head = 0
+	}
+}
+
+func (s *streamStore) remove(key string) {
+	if e, ok := s.entries[key]; ok {
+		s.bytes -= e.bytes
+		delete(s.entries, key)
+	}
+}
+
+// eventSize estimates the memory an event takes.
+func eventSize(event humio.StreamingResults) int {
+	size := eventOverhead
+	for k, v := range event {
+		size += len(k) + eventOverhead
+		if s, ok := v.(string); ok {
+			size += len(s)
+		} else {
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/stretchr/testify/require"
+)
+
+func storeEvent(raw string) humio.StreamingResults {
+	return humio.StreamingResults{"@rawstring": raw, "@timestamp": "1633132800000"}
+}
+
+func rawstrings(events []humio.StreamingResults) []string {
+	raws := make([]string, 0, len(events))
+	for _, e := range events {
+		raws = append(raws, e["@rawstring"].(string))
+	}
+	return raws
+}
+
+func TestStreamStore(t *testing.T) {
+	t.Run("keeps the last rows of each stream", func(t *testing.T) {
+		s := newStreamStore(3, time.Minute, 0)
+		s.Append("a", storeEvent("1"), storeEvent("2"))
+		s.Append("a", storeEvent("3"), storeEvent("4"), storeEvent("5"))
+		s.Append("b", storeEvent("x"))
+
+		require.Equal(t, []string{"3", "4", "5"}, rawstrings(s.Events("a")))
+		require.Equal(t, []string{"x"}, rawstrings(s.Events("b")))
+		require.Nil(t, s.Events("c"))
+	})
+
+	t.Run("evicts idle streams", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		s := newStreamStore(3, time.Minute, 0)
+		s.now = func() time.Time { return now }
+		s.Append("a", storeEvent("1"))
+		now = now.Add(30 * time.Second)
+		s.Append("b", storeEvent("2"))
+		now = now.Add(45 * time.Second)
+
+		require.Nil(t, s.Events("a"))
+		require.Equal(t, []string{"2"}, rawstrings(s.Events("b")))
+		require.Equal(t, 1, s.Len())
+	})
+
+	t.Run("drops the least recently used streams over the memory cap", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		s := newStreamStore(10, time.Hour, 3*eventSize(storeEvent("1")))
+		s.now = func() time.Time { return now }
+		s.Append("a", storeEvent("1"), storeEvent("2"))
+		now = now.Add(time.Second)
+		s.Append("b", storeEvent("3"), storeEvent("4"))
+
+		require.Nil(t, s.Events("a"))
+		require.Equal(t, []string{"3", "4"}, rawstrings(s.Events("b")))
+
+		s.Append("b", storeEvent("5"), storeEvent("6"))
+		require.Equal(t, []string{"4", "5", "6"}, rawstrings(s.Events("b")))
+		require.LessOrEqual(t, s.bytes, s.maxBytes)
+	})
+
+	t.Run("returns the events as a frame", func(t *testing.T) {
+		s := newStreamStore(3, time.Minute, 0)
+		f, err := s.Frame("a", "")
+		require.NoError(t, err)
+		require.Nil(t, f)
+
+		s.Append("a", storeEvent("1"), storeEvent("2"))
+		f, err = s.Frame("a", "")
+		require.NoError(t, err)
+		require.Equal(t, 2, f.Rows())
+	})
+}
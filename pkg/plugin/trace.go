@@ -0,0 +1,216 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/araddon/dateparse"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/lql"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Field names, in order of preference, that span events use for each column
+// of the trace frame.
+var (
+	traceIDFields       = []string{"traceId", "trace_id", "traceID", "trace.id"}
+	spanIDFields        = []string{"spanId", "span_id", "spanID", "span.id"}
+	parentSpanIDFields  = []string{"parentSpanId", "parent_span_id", "parentSpanID", "parentId", "parent_id", "parent.id"}
+	operationNameFields = []string{"operationName", "name", "span.name", "operation"}
+	serviceNameFields   = []string{"serviceName", "service.name", "resource.service.name", "service"}
+	startTimeFields     = []string{"startTime", "start_time", "startTimeUnixNano", "@timestamp"}
+)
+
+// durationFields maps the field names used for span durations to the factor
+// that converts them to milliseconds.
+var durationFields = []struct {
+	name  string
+	scale float64
+}{
+	{"duration", 1},
+	{"durationMs", 1},
+	{"duration_ms", 1},
+	{"durationNano", 1e-6},
+	{"durationNanos", 1e-6},
+	{"duration_ns", 1e-6},
+	{"duration_us", 1e-3},
+}
+
+// serviceTagPrefixes mark the fields that describe the service rather than the
+// span.
+var serviceTagPrefixes = []string{"service.", "resource."}
+
+// TraceKeyValuePair is a tag of a span or its service in the trace frame.
+type TraceKeyValuePair struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// TraceQuery turns a trace-by-ID query into an LQL query that searches for the
+// trace ID, narrowed by the query's own LQL if it has any.
+func TraceQuery(q humio.Query) (humio.Query, error) {
+	if err := ValidateQuery(q); err != nil {
+		return q, err
+	}
+	traceID := strings.TrimSpace(q.TraceID)
+	if traceID == "" {
+		return q, backend.DownstreamError(errors.New("enter a trace ID"))
+	}
+	p, err := lql.Parse(q.LSQL)
+	if err != nil {
+		return q, backend.DownstreamError(err)
+	}
+	if err := p.Prepend(strconv.Quote(traceID)); err != nil {
+		return q, backend.DownstreamError(err)
+	}
+	q.TraceID = traceID
+	q.LSQL = p.String()
+	q.FormatAs = humio.FormatTrace
+	return q, nil
+}
+
+// BuildTraceFrame converts span events into the trace frame used by the trace
+// view. When traceID is set, events of other traces that matched the search
+// are dropped. Fields not mapped to a column become span or service tags.
+func BuildTraceFrame(traceID string, r humio.QueryResult) (*data.Frame, error) {
+	traceIDField := firstEventField(r.Events, traceIDFields)
+	spanIDField := firstEventField(r.Events, spanIDFields)
+	if traceIDField == "" || spanIDField == "" {
+		return nil, backend.DownstreamError(errors.New("trace results need trace ID and span ID fields, such as traceId and spanId"))
+	}
+	parentSpanIDField := firstEventField(r.Events, parentSpanIDFields)
+	operationNameField := firstEventField(r.Events, operationNameFields)
+	serviceNameField := firstEventField(r.Events, serviceNameFields)
+	startTimeField := firstEventField(r.Events, startTimeFields)
+	durationField, durationScale := "", 1.0
+	for _, d := range durationFields {
+		if eventsHaveField(r.Events, d.name) {
+			durationField, durationScale = d.name, d.scale
+			break
+		}
+	}
+	mapped := map[string]bool{
+		traceIDField: true, spanIDField: true, parentSpanIDField: true, operationNameField: true,
+		serviceNameField: true, startTimeField: true, durationField: true,
+	}
+
+	frame := data.NewFrame("trace",
+		data.NewField("traceID", nil, []string{}),
+		data.NewField("spanID", nil, []string{}),
+		data.NewField("parentSpanID", nil, []string{}),
+		data.NewField("operationName", nil, []string{}),
+		data.NewField("serviceName", nil, []string{}),
+		data.NewField("serviceTags", nil, []json.RawMessage{}),
+		data.NewField("startTime", nil, []float64{}),
+		data.NewField("duration", nil, []float64{}),
+		data.NewField("tags", nil, []json.RawMessage{}),
+	)
+	for _, event := range r.Events {
+		eventTraceID := eventString(event, traceIDField)
+		if traceID != "" && eventTraceID != traceID {
+			continue
+		}
+		var tags, serviceTags []TraceKeyValuePair
+		for _, key := range sortedKeys(event) {
+			if mapped[key] || strings.HasPrefix(key, "@") || strings.HasPrefix(key, "#") {
+				continue
+			}
+			tag := TraceKeyValuePair{Key: key, Value: event[key]}
+			if hasAnyPrefix(key, serviceTagPrefixes) {
+				serviceTags = append(serviceTags, tag)
+			} else {
+				tags = append(tags, tag)
+			}
+		}
+		duration, _ := eventFloat(event, durationField)
+		frame.AppendRow(
+			eventTraceID,
+			eventString(event, spanIDField),
+			eventString(event, parentSpanIDField),
+			eventString(event, operationNameField),
+			eventString(event, serviceNameField),
+			traceTagsJSON(serviceTags),
+			spanStartTime(event[startTimeField]),
+			duration*durationScale,
+			traceTagsJSON(tags),
+		)
+	}
+
+	frame.Meta = &data.FrameMeta{PreferredVisualization: data.VisTypeTrace}
+	return frame, nil
+}
+
+// spanStartTime returns the start of a span in milliseconds since the epoch.
+// Numeric values are taken as milliseconds, microseconds or nanoseconds
+// depending on their magnitude.
+func spanStartTime(v any) float64 {
+	s := fmt.Sprint(v)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		switch {
+		case n > 1e17:
+			return n / 1e6
+		case n > 1e14:
+			return n / 1e3
+		}
+		return n
+	}
+	if t, err := dateparse.ParseAny(s); err == nil {
+		return float64(t.UnixNano()) / 1e6
+	}
+	return 0
+}
+
+func traceTagsJSON(tags []TraceKeyValuePair) json.RawMessage {
+	if tags == nil {
+		tags = []TraceKeyValuePair{}
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return json.RawMessage("[]")
+	}
+	return b
+}
+
+func eventFloat(event map[string]any, field string) (float64, bool) {
+	s := eventString(event, field)
+	if s == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func firstEventField(events []map[string]any, names []string) string {
+	for _, name := range names {
+		if eventsHaveField(events, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func sortedKeys(event map[string]any) []string {
+	keys := make([]string, 0, len(event))
+	for k := range event {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
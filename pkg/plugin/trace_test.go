@@ -0,0 +1,45 @@
+package plugin_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTraceFrame(t *testing.T) {
+	events := []map[string]any{
+		{"trace_id": "abc", "span_id": "1", "name": "GET /", "service.name": "web", "service.version": "1.2", "startTimeUnixNano": "1577836800000000000", "durationNano": "12000000", "http.status_code": "200", "@rawstring": "{}"},
+		{"trace_id": "abc", "span_id": "2", "parent_span_id": "1", "name": "SELECT", "service.name": "db", "startTimeUnixNano": "1577836800001000000", "durationNano": "5000000"},
+		{"trace_id": "other", "span_id": "3", "name": "unrelated", "service.name": "web", "startTimeUnixNano": "1577836800000000000", "durationNano": "1"},
+	}
+
+	frame, err := plugin.BuildTraceFrame("abc", humio.QueryResult{Events: events})
+	require.NoError(t, err)
+	require.Equal(t, []string{"traceID", "spanID", "parentSpanID", "operationName", "serviceName", "serviceTags", "startTime", "duration", "tags"}, fieldNames(frame))
+	require.Equal(t, 2, frame.Rows())
+
+	require.Equal(t, "1", frame.Fields[2].At(1))
+	require.Equal(t, "db", frame.Fields[4].At(1))
+	require.Equal(t, 1577836800001.0, frame.Fields[6].At(1))
+	require.Equal(t, 12.0, frame.Fields[7].At(0))
+
+	var tags []plugin.TraceKeyValuePair
+	require.NoError(t, json.Unmarshal(frame.Fields[8].At(0).(json.RawMessage), &tags))
+	require.Equal(t, []plugin.TraceKeyValuePair{{Key: "http.status_code", Value: "200"}}, tags)
+	var serviceTags []plugin.TraceKeyValuePair
+	require.NoError(t, json.Unmarshal(frame.Fields[5].At(0).(json.RawMessage), &serviceTags))
+	require.Equal(t, []plugin.TraceKeyValuePair{{Key: "service.version", Value: "1.2"}}, serviceTags)
+}
+
+func TestTraceQuery(t *testing.T) {
+	q, err := plugin.TraceQuery(humio.Query{Repository: "repo", TraceID: " abc "})
+	require.NoError(t, err)
+	require.Equal(t, `"abc"`, q.LSQL)
+	require.Equal(t, "abc", q.TraceID)
+
+	_, err = plugin.TraceQuery(humio.Query{TraceID: "abc"})
+	require.ErrorContains(t, err, "select a repository")
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Fields named __text and __value are used as the display text and value of
+// variable options when the query does not name other fields.
+const (
+	variableTextField  = "__text"
+	variableValueField = "__value"
+)
+
+type variableOption struct {
+	text  string
+	value string
+}
+
+// BuildVariableFrame converts results into template variable options with
+// separate text and value fields. Options are de-duplicated by value, sorted
+// by text and, when a regex is set, limited to the ones whose text matches it.
+// Queries without variable options and without __text or __value fields get
+// every field of the results as strings, as they did before the options.
+func BuildVariableFrame(opts humio.VariableOptions, fm FrameMarshallerFunc, r humio.QueryResult) (*data.Frame, error) {
+	if opts == (humio.VariableOptions{}) && !eventsHaveField(r.Events, variableTextField) && !eventsHaveField(r.Events, variableValueField) {
+		return fm("events", r.Events)
+	}
+
+	var re *regexp.Regexp
+	if opts.Regex != "" {
+		var err error
+		re, err = regexp.Compile(opts.Regex)
+		if err != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid variable regex: %w", err))
+		}
+	}
+
+	textField, valueField := resolveVariableFields(opts, r)
+	if textField == "" {
+		return nil, backend.DownstreamError(errors.New("variable results need at least one field"))
+	}
+
+	var options []variableOption
+	seen := map[string]bool{}
+	for _, event := range r.Events {
+		text := eventString(event, textField)
+		value := eventString(event, valueField)
+		if text == "" && value == "" {
+			continue
+		}
+		if text == "" {
+			text = value
+		}
+		if re != nil && !re.MatchString(text) {
+			continue
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		options = append(options, variableOption{text: text, value: value})
+	}
+	slices.SortStableFunc(options, func(a, b variableOption) int {
+		if c := compareNatural(a.text, b.text); c != 0 {
+			return c
+		}
+		return compareNatural(a.value, b.value)
+	})
+
+	texts := make([]string, len(options))
+	values := make([]string, len(options))
+	for i, o := range options {
+		texts[i] = o.text
+		values[i] = o.value
+	}
+	return data.NewFrame("events",
+		data.NewField("text", nil, texts),
+		data.NewField("value", nil, values),
+	), nil
+}
+
+// resolveVariableFields returns the fields holding the text and value of the
+// options: the ones configured on the query, then __text and __value, and
+// otherwise, when only a regex is set, the first field of the results for both.
+func resolveVariableFields(opts humio.VariableOptions, r humio.QueryResult) (string, string) {
+	text, value := opts.TextField, opts.ValueField
+	if text == "" && eventsHaveField(r.Events, variableTextField) {
+		text = variableTextField
+	}
+	if value == "" && eventsHaveField(r.Events, variableValueField) {
+		value = variableValueField
+	}
+	if text == "" && value == "" {
+		text = firstResultField(r)
+	}
+	if text == "" {
+		text = value
+	}
+	if value == "" {
+		value = text
+	}
+	return text, value
+}
+
+func firstResultField(r humio.QueryResult) string {
+	for _, field := range r.Metadata.FieldOrder {
+		if eventsHaveField(r.Events, field) {
+			return field
+		}
+	}
+	for _, event := range r.Events {
+		if keys := sortedKeys(event); len(keys) > 0 {
+			return keys[0]
+		}
+	}
+	return ""
+}
+
+// compareNatural orders numbers numerically before everything else, which is
+// ordered as strings.
+func compareNatural(a string, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(x, y)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return cmp.Compare(a, b)
+}
@@ -0,0 +1,74 @@
+package plugin_test
+
+import (
+	"testing"
+
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/humio"
+	"github.com/grafana/falconlogscale-datasource-backend/pkg/plugin"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/data/framestruct"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildVariableFrame(t *testing.T) {
+	hosts := []map[string]any{
+		{"ComputerName": "web-2", "aid": "b2"},
+		{"ComputerName": "web-10", "aid": "c3"},
+		{"ComputerName": "db-1", "aid": "a1"},
+		{"ComputerName": "web-2", "aid": "b2"},
+	}
+
+	t.Run("configured fields become text and value", func(t *testing.T) {
+		opts := humio.VariableOptions{TextField: "ComputerName", ValueField: "aid"}
+		frame, err := plugin.BuildVariableFrame(opts, framestruct.ToDataFrame, humio.QueryResult{Events: hosts})
+		require.NoError(t, err)
+		require.Equal(t, []string{"text", "value"}, fieldNames(frame))
+		require.Equal(t, []string{"db-1", "web-10", "web-2"}, stringValues(frame.Fields[0]))
+		require.Equal(t, []string{"a1", "c3", "b2"}, stringValues(frame.Fields[1]))
+	})
+	t.Run("__text and __value fields are used by convention", func(t *testing.T) {
+		events := []map[string]any{{"__text": "web", "__value": "1"}, {"__text": "db", "__value": "2"}}
+		frame, err := plugin.BuildVariableFrame(humio.VariableOptions{}, framestruct.ToDataFrame, humio.QueryResult{Events: events})
+		require.NoError(t, err)
+		require.Equal(t, []string{"db", "web"}, stringValues(frame.Fields[0]))
+		require.Equal(t, []string{"2", "1"}, stringValues(frame.Fields[1]))
+	})
+	t.Run("every field is returned without configuration", func(t *testing.T) {
+		result := humio.QueryResult{Events: hosts, Metadata: humio.QueryResultMetadata{FieldOrder: []string{"ComputerName", "aid"}}}
+		frame, err := plugin.BuildVariableFrame(humio.VariableOptions{}, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"ComputerName", "aid"}, fieldNames(frame))
+		require.Equal(t, len(hosts), frame.Rows())
+	})
+	t.Run("the first field is used for both when only a regex is set", func(t *testing.T) {
+		result := humio.QueryResult{Events: hosts, Metadata: humio.QueryResultMetadata{FieldOrder: []string{"ComputerName", "aid"}}}
+		frame, err := plugin.BuildVariableFrame(humio.VariableOptions{Regex: "-"}, framestruct.ToDataFrame, result)
+		require.NoError(t, err)
+		require.Equal(t, stringValues(frame.Fields[0]), stringValues(frame.Fields[1]))
+		require.Equal(t, []string{"db-1", "web-10", "web-2"}, stringValues(frame.Fields[0]))
+	})
+	t.Run("numbers are sorted numerically before strings", func(t *testing.T) {
+		events := []map[string]any{{"port": "443"}, {"port": "http"}, {"port": "80"}, {"port": "8080"}, {"port": "ftp"}}
+		frame, err := plugin.BuildVariableFrame(humio.VariableOptions{TextField: "port"}, framestruct.ToDataFrame, humio.QueryResult{Events: events})
+		require.NoError(t, err)
+		require.Equal(t, []string{"80", "443", "8080", "ftp", "http"}, stringValues(frame.Fields[0]))
+	})
+	t.Run("the regex filters on the text", func(t *testing.T) {
+		opts := humio.VariableOptions{TextField: "ComputerName", ValueField: "aid", Regex: "^web-"}
+		frame, err := plugin.BuildVariableFrame(opts, framestruct.ToDataFrame, humio.QueryResult{Events: hosts})
+		require.NoError(t, err)
+		require.Equal(t, []string{"web-10", "web-2"}, stringValues(frame.Fields[0]))
+	})
+	t.Run("an invalid regex is an error", func(t *testing.T) {
+		_, err := plugin.BuildVariableFrame(humio.VariableOptions{Regex: "("}, framestruct.ToDataFrame, humio.QueryResult{Events: hosts})
+		require.ErrorContains(t, err, "invalid variable regex")
+	})
+}
+
+func stringValues(f *data.Field) []string {
+	values := make([]string, f.Len())
+	for i := range values {
+		values[i] = f.At(i).(string)
+	}
+	return values
+}
@@ -3,10 +3,15 @@ import { DataSourceWithBackend } from '@grafana/runtime';
 import * as grafanaRuntime from '@grafana/runtime';
 import { expect } from '@jest/globals';
 import { mockDataSourceInstanceSettings, mockQuery } from 'components/__fixtures__/datasource';
-import { from, of } from 'rxjs';
+import { from, lastValueFrom, of } from 'rxjs';
 import { pluginVersion } from 'utils/version';
 import { DataSource } from './DataSource';
-import { FormatAs, LogScaleQuery, LogScaleQueryType } from './types';
+import { getLiveStreamPath } from 'streaming';
+import { FormatAs, LiveMode, LogScaleQuery, LogScaleQueryType } from './types';
+
+jest.mock('streaming', () => ({
+  getLiveStreamPath: jest.fn().mockResolvedValue('tail/v1/default/logscale-id/hash'),
+}));
 
 const getDataSource = () => {
   return new DataSource({
@@ -90,6 +95,54 @@ describe('DataSource', () => {
     });
   });
 
+  it('should request the saved searches of the default repository', async () => {
+    const ds = getDataSource();
+    ds.defaultRepository = 'foo';
+    ds.getResource = jest.fn().mockResolvedValue([]);
+
+    await ds.getSavedSearches('$defaultRepo');
+
+    expect(ds.getResource).toHaveBeenCalledWith('/savedSearches', { repository: 'foo' });
+  });
+
+  it('should return the text and value of variable options from `metricFindQuery`', () => {
+    const ds = getDataSource();
+    const queryResponse: DataQueryResponse = {
+      data: [
+        {
+          fields: [
+            { values: ['web-1', 'web-2'], type: FieldType.string, name: 'text', config: {} },
+            { values: ['a1', 'b2'], type: FieldType.string, name: 'value', config: {} },
+          ],
+          length: 2,
+        },
+      ],
+    };
+    ds.query = () => from([queryResponse]);
+
+    expect(ds.metricFindQuery({ ...mockQuery(), formatAs: FormatAs.Variable }, {})).resolves.toStrictEqual([
+      { text: 'web-1', value: 'a1' },
+      { text: 'web-2', value: 'b2' },
+    ]);
+  });
+
+  describe('Live queries', () => {
+    it('should subscribe with the data source uid and replace live aggregate results', async () => {
+      const getDataStream = jest.fn().mockReturnValue(of({ data: [] }));
+      jest.spyOn(grafanaRuntime, 'getGrafanaLiveSrv').mockReturnValue({ getDataStream } as any);
+      const ds = getDataSource();
+      const query = { ...mockQuery(), datasource: { uid: '$ds' }, live: true, liveMode: LiveMode.Aggregate };
+
+      const request = { targets: [query], range: { from: dateTime(0), to: dateTime(60000) } };
+      await lastValueFrom(ds.runLiveQuery(request as any));
+
+      expect(getLiveStreamPath).toHaveBeenCalledWith(ds.uid, expect.objectContaining({ start: '60s' }));
+      expect(getDataStream).toHaveBeenCalledWith(
+        expect.objectContaining({ buffer: { action: grafanaRuntime.StreamingFrameAction.Replace } })
+      );
+    });
+  });
+
   describe('Default repository', () => {
     const ds = getDataSource();
     let targets: LogScaleQuery[] = [];
@@ -11,18 +11,34 @@ import {
   ScopedVars,
   VariableSupportType,
 } from '@grafana/data';
-import { config, DataSourceWithBackend, getGrafanaLiveSrv, getTemplateSrv, TemplateSrv } from '@grafana/runtime';
+import {
+  config,
+  DataSourceWithBackend,
+  getGrafanaLiveSrv,
+  getTemplateSrv,
+  StreamingFrameAction,
+  TemplateSrv,
+} from '@grafana/runtime';
 import VariableQueryEditor from 'components/VariableEditor/VariableQueryEditor';
 import LanguageProvider from 'LanguageProvider';
 import { uniqueId } from 'lodash';
 import { migrateQuery } from 'migrations';
 import { defer, lastValueFrom, merge, mergeMap, Observable } from 'rxjs';
 import { map } from 'rxjs/operators';
-import { getLiveStreamKey } from 'streaming';
+import { getLiveStreamPath } from 'streaming';
 import { pluginVersion } from 'utils/version';
 import { transformBackendResult } from './logs';
 import { DEFAULT_OVERLAP_WINDOW, isEligibleForIncremental, QueryCache } from './incrementalQuery';
-import { DataSourceMode, FormatAs, LogScaleOptions, LogScaleQuery, LogScaleQueryType, NGSIEMRepos } from './types';
+import {
+  DataSourceMode,
+  FormatAs,
+  LiveMode,
+  LogScaleOptions,
+  LogScaleQuery,
+  LogScaleQueryType,
+  NGSIEMRepos,
+  SavedSearch,
+} from './types';
 
 export class DataSource
   extends DataSourceWithBackend<LogScaleQuery, LogScaleOptions>
@@ -143,17 +159,24 @@ export class DataSource
     const ds = this;
 
     const observables = request.targets.map((query, index) => {
-      return defer(() => getLiveStreamKey(query)).pipe(
-        mergeMap((key) => {
+      const data = {
+        ...query,
+        // live aggregates cover the dashboard's time span up to now
+        ...(query.liveMode === LiveMode.Aggregate && {
+          start: `${Math.max(1, Math.round((request.range.to.valueOf() - request.range.from.valueOf()) / 1000))}s`,
+        }),
+      };
+      return defer(() => getLiveStreamPath(ds.uid, data)).pipe(
+        mergeMap((path) => {
           return getGrafanaLiveSrv().getDataStream({
             addr: {
               scope: LiveChannelScope.DataSource,
               namespace: ds.uid,
-              path: `tail/${key}`,
-              data: {
-                ...query,
-              },
+              path,
+              data,
             },
+            // every live aggregate result is complete, so it replaces the previous one
+            ...(query.liveMode === LiveMode.Aggregate && { buffer: { action: StreamingFrameAction.Replace } }),
           });
         })
       );
@@ -180,6 +203,16 @@ export class DataSource
     return this.getResource('/repositories');
   }
 
+  async getSavedSearches(repository: string): Promise<SavedSearch[]> {
+    const resolved =
+      repository === '$defaultRepo' ? (this.defaultRepository ?? '') : this.templateSrv.replace(repository);
+    if (!resolved) {
+      return [];
+    }
+
+    return this.getResource('/savedSearches', { repository: resolved });
+  }
+
   async metricFindQuery(q: LogScaleQuery, options: any): Promise<MetricFindValue[]> {
     const request = {
       targets: [{ ...q, refId: 'A' }],
@@ -191,6 +224,12 @@ export class DataSource
       return [];
     }
     const frame: DataFrame = results.data[0];
+    // variable options come with separate text and value fields
+    const textField = frame.fields.find((f) => f.name === 'text');
+    const valueField = frame.fields.find((f) => f.name === 'value');
+    if (textField && valueField) {
+      return textField.values.map((text, i) => ({ text, value: valueField.values[i] }));
+    }
     return frame.fields[0].values.map((v) => ({ text: v }));
   }
 
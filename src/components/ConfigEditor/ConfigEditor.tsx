@@ -6,8 +6,10 @@ import {
   isValidDuration,
   onUpdateDatasourceJsonDataOptionChecked,
   SelectableValue,
+  onUpdateDatasourceSecureJsonDataOption,
   updateDatasourcePluginJsonDataOption,
   updateDatasourcePluginOption,
+  updateDatasourcePluginResetOption,
 } from '@grafana/data';
 import { Field, Input, SecretInput, Select, Switch, useTheme2 } from '@grafana/ui';
 import { DataLinks } from '../DataLinks';
@@ -56,6 +58,28 @@ export const ConfigEditor: React.FC<Props> = (props: Props) => {
     options.jsonData.incrementalQueryOverlapWindow ?? '10m'
   );
 
+  const onStreamOptionChange =
+    (
+      key:
+        | 'streamFlushIntervalMs'
+        | 'streamBatchSize'
+        | 'streamMaxEventsPerSecond'
+        | 'streamStallTimeoutSeconds'
+        | 'streamCacheRows'
+        | 'streamCacheTTLSeconds'
+        | 'streamCacheMaxBytes'
+    ) =>
+    (e: React.FormEvent<HTMLInputElement>) => {
+      const value = parseInt(e.currentTarget.value, 10);
+      updateDatasourcePluginJsonDataOption({ options, onOptionsChange }, key, isNaN(value) ? undefined : value);
+    };
+
+  const ingestRoleOptions: Array<SelectableValue<string>> = [
+    { label: 'Viewer', value: 'Viewer' },
+    { label: 'Editor', value: 'Editor' },
+    { label: 'Admin', value: 'Admin' },
+  ];
+
   const selectedMode = options.jsonData.mode || DataSourceMode.LogScale;
   const isNGSIEMMode = selectedMode === DataSourceMode.NGSIEM;
   const clearAuthSettings = () => {
@@ -345,6 +369,133 @@ export const ConfigEditor: React.FC<Props> = (props: Props) => {
           </Field>
         )}
 
+        <Field
+          label="Live tail flush interval"
+          description="Milliseconds to buffer live tail events before sending them to the browser. Defaults to 500."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="500"
+            value={options.jsonData.streamFlushIntervalMs ?? ''}
+            onChange={onStreamOptionChange('streamFlushIntervalMs')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail batch size"
+          description="Number of buffered live tail events that are sent without waiting for the flush interval. Defaults to 500."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="500"
+            value={options.jsonData.streamBatchSize ?? ''}
+            onChange={onStreamOptionChange('streamBatchSize')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail max events per second"
+          description="Events above this rate are dropped and reported with a notice. Leave empty for no limit."
+        >
+          <Input
+            type="number"
+            width={20}
+            value={options.jsonData.streamMaxEventsPerSecond ?? ''}
+            onChange={onStreamOptionChange('streamMaxEventsPerSecond')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail stall timeout"
+          description="Seconds a live tail may go without data before it is reconnected. Defaults to 300."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="300"
+            value={options.jsonData.streamStallTimeoutSeconds ?? ''}
+            onChange={onStreamOptionChange('streamStallTimeoutSeconds')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail cached rows"
+          description="Number of recent events kept per live tail and sent to new subscribers. Defaults to 1000."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="1000"
+            value={options.jsonData.streamCacheRows ?? ''}
+            onChange={onStreamOptionChange('streamCacheRows')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail cache TTL"
+          description="Seconds a live tail's cached events are kept after it was last used. Defaults to 600."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="600"
+            value={options.jsonData.streamCacheTTLSeconds ?? ''}
+            onChange={onStreamOptionChange('streamCacheTTLSeconds')}
+          />
+        </Field>
+
+        <Field
+          label="Live tail cache size"
+          description="Maximum bytes of cached events across all live tails of this data source. Defaults to 33554432 (32 MiB)."
+        >
+          <Input
+            type="number"
+            width={20}
+            placeholder="33554432"
+            value={options.jsonData.streamCacheMaxBytes ?? ''}
+            onChange={onStreamOptionChange('streamCacheMaxBytes')}
+          />
+        </Field>
+
+        <Field
+          label="Ingest events"
+          description="Let Grafana users write events such as annotations back to LogScale with a separate ingest token."
+        >
+          <div className={styles.toggle}>
+            <Switch
+              value={options.jsonData.ingestEnabled ?? false}
+              onChange={onUpdateDatasourceJsonDataOptionChecked(props, 'ingestEnabled')}
+            />
+          </div>
+        </Field>
+
+        {options.jsonData.ingestEnabled && (
+          <>
+            <Field label="Ingest token" description="Ingest token of the repository events are written to.">
+              <SecretInput
+                width={40}
+                placeholder="Ingest token"
+                value={options.secureJsonData?.ingestToken}
+                isConfigured={Boolean(options.secureJsonFields?.ingestToken)}
+                onChange={onUpdateDatasourceSecureJsonDataOption(props, 'ingestToken')}
+                onReset={() => updateDatasourcePluginResetOption(props, 'ingestToken')}
+              />
+            </Field>
+            <Field label="Minimum ingest role" description="Lowest Grafana role allowed to ingest events. Defaults to Editor.">
+              <Select
+                width={20}
+                options={ingestRoleOptions}
+                value={options.jsonData.ingestMinRole ?? 'Editor'}
+                onChange={(v) =>
+                  updateDatasourcePluginJsonDataOption({ options, onOptionsChange }, 'ingestMinRole', v.value)
+                }
+              />
+            </Field>
+          </>
+        )}
+
         {config.secureSocksDSProxyEnabled && (
           <>
             <div className="gf-form-group">
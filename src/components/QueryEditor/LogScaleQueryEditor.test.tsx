@@ -2,6 +2,7 @@ import React from 'react';
 import { render, waitFor, screen, act } from '@testing-library/react';
 import userEvent from '@testing-library/user-event';
 import { mockDatasource } from '../__fixtures__/datasource';
+import { LogScaleQueryType } from '../../types';
 import { LogScaleQueryEditor, Props } from './LogScaleQueryEditor';
 
 const getDefaultProps = (): Props => {
@@ -91,6 +92,25 @@ describe('<LogScaleQueryEditor />', () => {
     });
   });
 
+  it('should set the saved search picked from the repository', async () => {
+    const props = getDefaultProps();
+    props.query.queryType = LogScaleQueryType.SavedSearch;
+    props.query.repository = 'repository_1';
+    props.datasource.getSavedSearches = jest.fn().mockResolvedValue([
+      { id: '1', name: 'failed-logins', displayName: 'Failed logins', queryString: 'status=failed' },
+    ]);
+
+    render(<LogScaleQueryEditor {...props} />);
+    expect(props.datasource.getSavedSearches).toHaveBeenCalledWith('repository_1');
+
+    // the second select box lists the saved searches
+    await userEvent.type(screen.getAllByRole('combobox')[1], '{Space}');
+    await userEvent.click(await screen.findByText('Failed logins'));
+
+    expect(props.onChange).toHaveBeenCalledWith({ ...props.query, savedSearch: 'failed-logins' });
+    expect(props.onRunQuery).toHaveBeenCalled();
+  });
+
   it('should render query', async () => {
     const queryString = 'SOME TEST QUERY';
     const props = getDefaultProps();
@@ -3,7 +3,7 @@ import { QueryEditorProps, SelectableValue, toOption } from '@grafana/data';
 import { Select, QueryField } from '@grafana/ui';
 import { EditorRows, EditorRow, EditorField } from '@grafana/plugin-ui';
 import { DataSource } from '../../DataSource';
-import { LogScaleOptions, LogScaleQuery } from '../../types';
+import { LogScaleOptions, LogScaleQuery, LogScaleQueryType } from '../../types';
 import { parseRepositoriesResponse } from '../../utils/utils';
 import { selectors } from 'e2e/selectors';
 
@@ -36,6 +36,20 @@ export function LogScaleQueryEditor(props: Props) {
     });
   }, [datasource, variableOptionGroup]);
 
+  const isSavedSearch = query.queryType === LogScaleQueryType.SavedSearch;
+  const [savedSearches, setSavedSearches] = useState<Array<SelectableValue<string>>>([]);
+
+  useEffect(() => {
+    if (!isSavedSearch) {
+      return;
+    }
+    datasource.getSavedSearches(query.repository).then((result) => {
+      setSavedSearches(
+        result.map((s) => ({ label: s.displayName || s.name, value: s.name, description: s.description }))
+      );
+    });
+  }, [datasource, isSavedSearch, query.repository]);
+
   useEffect(() => {
     if (datasource.defaultRepository && !query.repository) {
       onChange({ ...query, repository: datasource.defaultRepository });
@@ -44,17 +58,19 @@ export function LogScaleQueryEditor(props: Props) {
 
   return (
     <EditorRows>
-      <EditorRow>
-        <EditorField label="Query" width={'100%'} data-testid={selectors.components.queryEditor.queryField.input}>
-          <QueryField
-            query={query.lsql}
-            onChange={(val) => onChange({ ...query, lsql: val })}
-            onRunQuery={onRunQuery}
-            placeholder="Enter a LogScale query (run with Shift+Enter)"
-            portalOrigin="LogScale"
-          />
-        </EditorField>
-      </EditorRow>
+      {!isSavedSearch && (
+        <EditorRow>
+          <EditorField label="Query" width={'100%'} data-testid={selectors.components.queryEditor.queryField.input}>
+            <QueryField
+              query={query.lsql}
+              onChange={(val) => onChange({ ...query, lsql: val })}
+              onRunQuery={onRunQuery}
+              placeholder="Enter a LogScale query (run with Shift+Enter)"
+              portalOrigin="LogScale"
+            />
+          </EditorField>
+        </EditorRow>
+      )}
       <EditorRow>
         <EditorField label="Repository">
           <Select
@@ -65,6 +81,21 @@ export function LogScaleQueryEditor(props: Props) {
             data-testid={selectors.components.queryEditor.repository.input}
           />
         </EditorField>
+        {isSavedSearch && (
+          <EditorField label="Saved search" tooltip="Saved searches of the selected repository.">
+            <Select
+              width={30}
+              options={savedSearches}
+              value={query.savedSearch}
+              allowCustomValue
+              onChange={(val) => {
+                onChange({ ...query, savedSearch: val.value });
+                onRunQuery();
+              }}
+              data-testid={selectors.components.queryEditor.savedSearch.input}
+            />
+          </EditorField>
+        )}
       </EditorRow>
     </EditorRows>
   );
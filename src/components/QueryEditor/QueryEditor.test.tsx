@@ -1,8 +1,9 @@
 import React from 'react';
-import { render, waitFor } from '@testing-library/react';
+import { render, screen, waitFor } from '@testing-library/react';
 import { mockDatasource, mockQuery } from '../__fixtures__/datasource';
 import { QueryEditor, Props } from './QueryEditor';
 import { pluginVersion } from 'utils/version';
+import { LogScaleQueryType } from '../../types';
 
 const getDefaultProps = (): Props => {
   const props: Props = {
@@ -41,4 +42,14 @@ describe('<QueryEditor />', () => {
       expect(props.onChange).toHaveBeenCalledWith(expect.objectContaining({ version: pluginVersion }))
     );
   });
+
+  it('should offer repository metadata as a query type without a query field', async () => {
+    const props = getDefaultProps();
+    props.query.queryType = LogScaleQueryType.RepositoryMetadata;
+
+    render(<QueryEditor {...props} />);
+
+    await waitFor(() => expect(screen.getByLabelText('Repository metadata')).toBeChecked());
+    expect(screen.queryByText('Repository')).not.toBeInTheDocument();
+  });
 });
@@ -2,16 +2,34 @@ import React, { useEffect } from 'react';
 import { QueryEditorProps } from '@grafana/data';
 import { EditorField, EditorRow } from '@grafana/plugin-ui';
 import { DataSource } from '../../DataSource';
-import { FormatAs, LogScaleOptions, LogScaleQuery, LogScaleQueryType } from '../../types';
+import { FormatAs, LiveMode, LogScaleOptions, LogScaleQuery, LogScaleQueryType } from '../../types';
 import { LogScaleQueryEditor } from 'components/QueryEditor/LogScaleQueryEditor';
-import { Field, Switch } from '@grafana/ui';
+import { Field, RadioButtonGroup, Switch } from '@grafana/ui';
 import { pluginVersion } from 'utils/version';
 
+const liveModeOptions = [
+  { label: 'Tail', value: LiveMode.Tail, description: 'Stream every new event' },
+  { label: 'Aggregate', value: LiveMode.Aggregate, description: 'Keep a live query job running and stream its result' },
+];
+
+const queryTypeOptions = [
+  { label: 'Query', value: LogScaleQueryType.LQL },
+  { label: 'Saved search', value: LogScaleQueryType.SavedSearch, description: 'Run a saved search of the repository' },
+  {
+    label: 'Repository metadata',
+    value: LogScaleQueryType.RepositoryMetadata,
+    description: 'List the retention and size of every repository and view',
+  },
+];
+
 export type Props = QueryEditorProps<DataSource, LogScaleQuery, LogScaleOptions>;
 
 export function QueryEditor(props: Props) {
   const { query, onChange, onRunQuery } = props;
   const isLogFormat = query.formatAs === FormatAs.Logs;
+  const isRepositoryMetadata = query.queryType === LogScaleQueryType.RepositoryMetadata;
+  const queryType =
+    query.queryType === LogScaleQueryType.SavedSearch || isRepositoryMetadata ? query.queryType : LogScaleQueryType.LQL;
 
   // This sets the query type to logs if the user is in Explore and the query type is not set
   useEffect(() => {
@@ -37,9 +55,23 @@ export function QueryEditor(props: Props) {
     onRunQuery();
   };
 
+  const onQueryTypeChange = (queryType: LogScaleQueryType) => {
+    onChange({ ...query, queryType });
+    onRunQuery();
+  };
+
   return (
     <div>
-      <LogScaleQueryEditor {...props} />
+      <EditorRow>
+        <EditorField label="Query type">
+          <RadioButtonGroup
+            options={queryTypeOptions}
+            value={queryType}
+            onChange={onQueryTypeChange}
+          />
+        </EditorField>
+      </EditorRow>
+      {!isRepositoryMetadata && <LogScaleQueryEditor {...props} />}
       {props.app === 'explore' ? (
         <EditorRow>
           <Field label="Format as logs">
@@ -59,6 +91,18 @@ export function QueryEditor(props: Props) {
             <EditorField label="Enable live querying">
               <Switch id="liveQuerying" value={query.live || false} onChange={onLiveQueryChange} />
             </EditorField>
+            {query.live && (
+              <EditorField label="Live mode" tooltip="Use Aggregate for queries such as timeChart or groupBy.">
+                <RadioButtonGroup
+                  options={liveModeOptions}
+                  value={query.liveMode ?? LiveMode.Tail}
+                  onChange={(liveMode) => {
+                    onChange({ ...query, liveMode });
+                    onRunQuery();
+                  }}
+                />
+              </EditorField>
+            )}
             {props.datasource.isIncrementalQueryingEnabled() && (
               <EditorField
                 label="Incremental querying"
@@ -1,11 +1,11 @@
 import { SelectableValue } from '@grafana/data';
-import { Field, Select } from '@grafana/ui';
+import { Field, Input, Select } from '@grafana/ui';
 import { LogScaleQueryEditor } from 'components/QueryEditor/LogScaleQueryEditor';
 import { DataSource } from 'DataSource';
 import { selectors } from 'e2e/selectors';
 import React from 'react';
 import { useEffectOnce } from 'react-use';
-import { LogScaleQueryType, LogScaleQuery, FormatAs } from 'types';
+import { LogScaleQueryType, LogScaleQuery, FormatAs, VariableOptions } from 'types';
 
 export type Props = {
   query: LogScaleQuery;
@@ -52,6 +52,13 @@ const VariableQueryEditor = (props: Props) => {
     }
   };
 
+  const onVariableOptionChange = (key: keyof VariableOptions) => (e: React.FormEvent<HTMLInputElement>) => {
+    onChange({
+      ...query,
+      variable: { ...query.variable, [key]: e.currentTarget.value },
+    });
+  };
+
   return (
     <>
       <Field label="Query Type" data-testid={selectors.components.variableEditor.queryType.input}>
@@ -71,6 +78,34 @@ const VariableQueryEditor = (props: Props) => {
           query={query ?? {}}
         />
       )}
+      {query.queryType === LogScaleQueryType.LQL && (
+        <>
+          <Field label="Text field" description="Field shown as the option text. Defaults to __text or the first field.">
+            <Input
+              aria-label="text field"
+              width={25}
+              value={query.variable?.textField ?? ''}
+              onChange={onVariableOptionChange('textField')}
+            />
+          </Field>
+          <Field label="Value field" description="Field used as the option value. Defaults to __value or the text field.">
+            <Input
+              aria-label="value field"
+              width={25}
+              value={query.variable?.valueField ?? ''}
+              onChange={onVariableOptionChange('valueField')}
+            />
+          </Field>
+          <Field label="Regex" description="Only keep options whose text matches this regex.">
+            <Input
+              aria-label="variable regex"
+              width={25}
+              value={query.variable?.regex ?? ''}
+              onChange={onVariableOptionChange('regex')}
+            />
+          </Field>
+        </>
+      )}
     </>
   );
 };
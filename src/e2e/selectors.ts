@@ -16,6 +16,9 @@ export const components = {
     repository: {
       input: 'data-testid repository',
     },
+    savedSearch: {
+      input: 'data-testid saved-search',
+    },
   },
   variableEditor: {
     queryType: {
@@ -1,17 +1,29 @@
 import { config } from '@grafana/runtime';
-import { LogScaleQuery } from 'types';
+import { LiveMode, LogScaleQuery } from 'types';
 
 /**
- * Calculate a unique key for the query.  The key is used to pick a channel and should
- * be unique for each distinct query execution plan.  This key is not secure and is only picked to avoid
- * possible collisions
+ * Calculate the live channel path for the query: tail/v1/<namespace>/<datasource uid>/<query hash>.
+ * The hash covers the normalized query, so the same query from different panels shares a channel.
+ * It must match StreamChannelPath in the backend, which rejects subscriptions whose query does not
+ * hash to the path. The UID is the data source instance's own, as query.datasource may hold a
+ * variable or be missing for default and mixed data sources.
  */
-export async function getLiveStreamKey(query: LogScaleQuery): Promise<string> {
-  const str = JSON.stringify({ expr: query.lsql, repo: query.repository, format: query.formatAs });
+export async function getLiveStreamPath(
+  datasourceUid: string,
+  query: LogScaleQuery & { start?: string }
+): Promise<string> {
+  const normalized = [
+    (query.repository ?? '').trim(),
+    (query.lsql ?? '').trim(),
+    query.formatAs ?? '',
+    query.liveMode ?? LiveMode.Tail,
+    query.start ?? '',
+  ].join('\u0000');
 
   const namespace = config.bootData.settings.namespace;
-  const msgUint8 = new TextEncoder().encode(str); // encode as (utf-8) Uint8Array
-  const hashBuffer = await crypto.subtle.digest('SHA-1', msgUint8); // hash the message
-  const hashArray = Array.from(new Uint8Array(hashBuffer.slice(0, 8))); // first 8 bytes
-  return `${query.datasource?.uid}/${hashArray.map((b) => b.toString(16).padStart(2, '0')).join('')}/${namespace}`;
+  const msgUint8 = new TextEncoder().encode(normalized); // encode as (utf-8) Uint8Array
+  const hashBuffer = await crypto.subtle.digest('SHA-256', msgUint8); // hash the message
+  const hashArray = Array.from(new Uint8Array(hashBuffer.slice(0, 16))); // first 16 bytes
+  const hash = hashArray.map((b) => b.toString(16).padStart(2, '0')).join('');
+  return `tail/v1/${namespace}/${datasourceUid}/${hash}`;
 }
@@ -20,33 +20,87 @@ export interface LogScaleOptions extends DataSourceJsonData {
   mode?: DataSourceMode;
   incrementalQuerying?: boolean;
   incrementalQueryOverlapWindow?: string;
+  streamFlushIntervalMs?: number;
+  streamBatchSize?: number;
+  streamMaxEventsPerSecond?: number;
+  streamStallTimeoutSeconds?: number;
+  streamCacheRows?: number;
+  streamCacheTTLSeconds?: number;
+  streamCacheMaxBytes?: number;
+  ingestEnabled?: boolean;
+  ingestMinRole?: string;
 }
 
 export interface SecretLogScaleOptions extends DataSourceJsonData {
   accessToken?: string;
   basicAuthPassword?: string;
   oauth2ClientSecret?: string;
+  ingestToken?: string;
 }
 
 export interface LogScaleQuery extends DataQuery {
   repository: string;
   lsql: string;
   live?: boolean;
+  liveMode?: LiveMode;
   queryType: LogScaleQueryType;
   formatAs: FormatAs;
   version: string;
   disableIncrementalQuerying?: boolean;
+  savedSearch?: string;
+  autoSpan?: boolean;
+  repositoryType?: 'repository' | 'view';
+  arguments?: Record<string, string>;
+  nodeGraph?: NodeGraphOptions;
+  traceId?: string;
+  variable?: VariableOptions;
+}
+
+export enum LiveMode {
+  Tail = 'tail',
+  Aggregate = 'aggregate',
 }
 
 export enum LogScaleQueryType {
   Repositories = 'Repositories',
   LQL = 'LQL',
+  SavedSearch = 'SavedSearch',
+  RepositoryMetadata = 'RepositoryMetadata',
+  TraceID = 'TraceID',
+}
+
+export interface NodeGraphOptions {
+  sourceField?: string;
+  targetField?: string;
+  titleField?: string;
+  subtitleField?: string;
+  metricField?: string;
+}
+
+export interface SavedSearch {
+  id: string;
+  name: string;
+  displayName: string;
+  description?: string;
+  queryString: string;
+}
+
+export interface VariableOptions {
+  textField?: string;
+  valueField?: string;
+  regex?: string;
 }
 
 export enum FormatAs {
   Logs = 'logs',
   Metrics = 'metrics',
   Variable = 'variable',
+  Table = 'table',
+  TimeSeriesLong = 'timeseries-long',
+  Heatmap = 'heatmap',
+  Geomap = 'geomap',
+  NodeGraph = 'nodeGraph',
+  Trace = 'trace',
 }
 
 export const NGSIEMRepos = ['search-all', 'investigate_view', 'third-party'];